@@ -0,0 +1,140 @@
+// Package baseline queries a vanilla LLM without any agentic logic
+package baseline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+// defaultQueries are the example queries used when none are given
+var defaultQueries = []string{
+	"What's the response time for wolt.com?",
+	"What version of Golang is installed on this machine?",
+	"What's the weather in Helsinki today?",
+}
+
+// loadPrompt returns the baseline system prompt from the prompt library
+func loadPrompt() (*internal.Prompt, error) {
+	library, err := internal.LoadPrompts()
+	if err != nil {
+		return nil, err
+	}
+	return library.Get("baseline")
+}
+
+// queryModel streams the completion to out while it's generated and returns the full response
+func queryModel(ctx context.Context, client openai.Client, tracker *internal.UsageTracker, options internal.RunOptions, system *internal.Prompt, step int, prompt string, out io.Writer) (answer string, err error) {
+	ctx, span := internal.StartSpan(ctx, internal.SpanRun, "baseline")
+	span.Input = prompt
+	span.SetAttribute("prompt", system.ID())
+	defer func() {
+		span.Output = answer
+		span.Finish(err)
+	}()
+
+	instructions, err := system.Render(internal.PromptVars(nil))
+	if err != nil {
+		return "", err
+	}
+
+	params := openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.UserMessage(prompt),
+			openai.SystemMessage(instructions),
+		},
+		Model: options.ModelOr(shared.ChatModelGPT4o),
+	}
+	if options.Temperature != nil {
+		params.Temperature = openai.Float(*options.Temperature)
+	}
+
+	chatCompletion, err := internal.StreamChatCompletion(
+		ctx,
+		client,
+		params,
+		internal.NewTerminalStreamHandler(out),
+	)
+	fmt.Fprintln(out)
+
+	if err != nil {
+		return "", &internal.ModelError{Model: params.Model, Step: step, Err: err}
+	}
+	tracker.RecordCompletion("baseline", step, chatCompletion)
+
+	// A truncated answer is still returned, along with the error
+	content, err := internal.CompletionContent(chatCompletion)
+	if err != nil {
+		return content, &internal.ModelError{Model: params.Model, Step: step, Err: err}
+	}
+
+	return content, nil
+}
+
+// Run sends every query straight to the model
+func Run(ctx context.Context, options internal.RunOptions) error {
+	client := internal.NewOpenAIClient()
+	tracker, err := internal.NewUsageTrackerFromEnv()
+	if err != nil {
+		return fmt.Errorf("error loading price table: %w", err)
+	}
+	system, err := loadPrompt()
+	if err != nil {
+		return err
+	}
+
+	out := options.Console()
+
+	for i, query := range options.QueriesOr(defaultQueries...) {
+		if i > 0 {
+			fmt.Fprintln(out, "--------------------------------")
+			fmt.Fprintln(out, "--------------------------------")
+			fmt.Fprintln(out, "--------------------------------")
+		}
+
+		result := internal.RunResult{Query: query}
+		answer, err := queryModel(ctx, client, tracker, options, system, i+1, query, out)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Answer = answer
+
+		// The answer was already streamed, unless it's printed as JSON or streaming is off
+		if options.Output == "json" || options.Quiet {
+			internal.PrintResult(os.Stdout, options.Output, result)
+		}
+	}
+
+	tracker.PrintSummary(out)
+	if err := tracker.WriteReport("usage_report.json"); err != nil {
+		return fmt.Errorf("error writing usage report: %w", err)
+	}
+
+	return nil
+}
+
+// NewAnswerer returns an answerer sending each query straight to the model
+func NewAnswerer(ctx context.Context, options internal.RunOptions) (internal.Answerer, error) {
+	client := internal.NewOpenAIClient()
+	tracker, err := internal.NewUsageTrackerFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("error loading price table: %w", err)
+	}
+	system, err := loadPrompt()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, query string) (internal.Answer, error) {
+		queryTracker := tracker.Fork()
+		text, err := queryModel(ctx, client, queryTracker, options, system, 1, query, io.Discard)
+
+		report := queryTracker.Report()
+		return internal.Answer{Text: text, Steps: report.Total.Calls, Usage: report.Total}, err
+	}, nil
+}
@@ -0,0 +1,631 @@
+// Package basicagent implements a ReAct agent loop from scratch, without any framework
+package basicagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	"github.com/openai/openai-go"
+)
+
+const (
+	// defaultModel is the agent's model without --model
+	defaultModel = "gpt-4o"
+	// contextBudget keeps the conversation well below gpt-4o's 128k context window
+	contextBudget = 32000
+	// maxObservationTokens caps a single observation, scraped pages are usually much bigger
+	maxObservationTokens = 4000
+
+	// pageChunkSize is the size of scraped page chunks in characters
+	pageChunkSize = 2000
+	// pagePreviewChars is how much of a page is shown right after scraping
+	pagePreviewChars = 500
+	// findInPageLimit is the maximum number of chunks returned by find_in_page
+	findInPageLimit = 3
+)
+
+// defaultQueries are the example queries used when none are given
+var defaultQueries = []string{
+	"What's the response time for wolt.com?",
+	"What version of Golang is installed on this machine?",
+	"What is the weather in Helsinki today (in Celsius)? Also print time when the weather was checked. Peferably from accuweather",
+}
+
+// actionSpec describes an action the model may run. The system prompt's action catalog is rendered from it.
+type actionSpec struct {
+	Name        string
+	Description string
+	// Args is the input format, e.g. <url>
+	Args string
+	// Example is an example input
+	Example string
+
+	run func(ctx context.Context, pages *internal.PageStore, input string) (string, error)
+}
+
+// actions are all registered actions, in the order they're described to the model
+var actions = []actionSpec{
+	{
+		Name:        "ping",
+		Description: "Does a ping command and return the response time in seconds",
+		Args:        "<website>",
+		Example:     "wolt.com",
+		run: func(ctx context.Context, pages *internal.PageStore, input string) (string, error) {
+			return ping(ctx, input)
+		},
+	},
+	{
+		Name:        "bash",
+		Description: "Returns the result of bash command execution",
+		Args:        "<command>",
+		Example:     "go version",
+		run: func(ctx context.Context, pages *internal.PageStore, input string) (string, error) {
+			return bash(ctx, input)
+		},
+	},
+	{
+		Name:        "web_search",
+		Description: "Returns json with the urls of search results",
+		Args:        "<query>",
+		Example:     "capital of Portugal",
+		run: func(ctx context.Context, pages *internal.PageStore, input string) (string, error) {
+			return webSearch(input)
+		},
+	},
+	{
+		Name:        "scrape",
+		Description: "Stores the content of the given URL and returns its page id, the beginning of the page and its chunk ids",
+		Args:        "<url>",
+		Example:     "https://www.wolt.com",
+		run:         scrape,
+	},
+	{
+		Name:        "read_chunk",
+		Description: "Returns the text of a chunk of a scraped page",
+		Args:        "<chunk id>",
+		Example:     "p1#2",
+		run:         readChunk,
+	},
+	{
+		Name:        "find_in_page",
+		Description: "Returns the chunks of a scraped page containing the most of the keywords. Only exact words match, not synonyms or other forms",
+		Args:        "<page id> <keywords>",
+		Example:     "p1 temperature today",
+		run:         findInPage,
+	},
+}
+
+// findAction returns the registered action with the given name
+func findAction(name string) (actionSpec, bool) {
+	for _, action := range actions {
+		if action.Name == name {
+			return action, true
+		}
+	}
+	return actionSpec{}, false
+}
+
+// actionNames returns the names of the given actions
+func actionNames(actions []actionSpec) []string {
+	names := make([]string, 0, len(actions))
+	for _, action := range actions {
+		names = append(names, action.Name)
+	}
+	return names
+}
+
+// Action handlers, their errors are classified by internal.NewToolError
+func ping(ctx context.Context, website string) (string, error) {
+	if !strings.HasPrefix(website, "https://") && !strings.HasPrefix(website, "http://") {
+		website = "https://" + website
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, website, nil)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	duration := time.Since(start).Seconds()
+	return fmt.Sprintf("%.2f seconds", duration), nil
+}
+
+func bash(ctx context.Context, command string) (string, error) {
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func webSearch(query string) (string, error) {
+	// Create search client for finding URLs
+	searchClient := internal.NewSearchClient()
+
+	results, err := searchClient.Search(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to search the web: %w", err)
+	}
+
+	if len(results) == 0 {
+		return "No results found", nil
+	}
+
+	jsonResults, err := json.Marshal(results)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal results: %w", err)
+	}
+
+	return string(jsonResults), nil
+}
+
+func scrape(ctx context.Context, pages *internal.PageStore, url string) (string, error) {
+	scraperClient := internal.NewScraperClient()
+	page, err := pages.Scrape(scraperClient, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to scrape content: %w", err)
+	}
+
+	return page.Overview(pagePreviewChars), nil
+}
+
+func readChunk(ctx context.Context, pages *internal.PageStore, id string) (string, error) {
+	chunk, ok := pages.Chunk(id)
+	if !ok {
+		return "", fmt.Errorf("unknown chunk: %s", id)
+	}
+
+	return chunk.Text, nil
+}
+
+func findInPage(ctx context.Context, pages *internal.PageStore, input string) (string, error) {
+	pageID, query, _ := strings.Cut(strings.TrimSpace(input), " ")
+
+	chunks, err := pages.Find(pageID, query, findInPageLimit)
+	if err != nil {
+		return "", fmt.Errorf("failed to search page: %w", err)
+	}
+
+	return internal.FormatChunks(chunks), nil
+}
+
+// pauseDetector streams tokens to the terminal and stops the completion once the model pauses,
+// so the action runs right away and made up observations are neither generated nor shown.
+// The action is parsed from the response up to the pause, as its input may span several lines.
+type pauseDetector struct {
+	*internal.TerminalStreamHandler
+}
+
+func newPauseDetector(out io.Writer) *pauseDetector {
+	return &pauseDetector{TerminalStreamHandler: internal.NewTerminalStreamHandler(out)}
+}
+
+// OnLine stops the output on a Pause or Observation line
+func (d *pauseDetector) OnLine(line string) bool {
+	matches := stopLineRegex.FindStringSubmatch(line)
+	return matches != nil && (strings.EqualFold(matches[1], "pause") || strings.EqualFold(matches[1], "observation"))
+}
+
+// agent holds everything the thought-action-observation loop needs
+type agent struct {
+	client         openai.Client
+	tracker        *internal.UsageTracker
+	contextManager *internal.ContextManager
+	session        *internal.Session
+	model          string
+	temperature    *float64
+	maxIter        int
+	// tools lists the enabled actions, all are enabled if empty
+	tools []string
+	// trace prints the full observations of tool calls
+	trace bool
+	// out receives the streamed model output
+	out io.Writer
+	// prompt renders the system prompt from the enabled actions
+	prompt *promptTemplate
+}
+
+// newAgent creates an agent with its own context manager, sharing the tokenizer
+func newAgent(client openai.Client, tracker *internal.UsageTracker, tokenizer internal.Tokenizer, session *internal.Session, prompt *promptTemplate, options internal.RunOptions) *agent {
+	summarizer := internal.NewOpenAISummarizer(client, "gpt-4o-mini", tracker)
+	contextManager := internal.NewContextManager(tokenizer, internal.ContextOptions{
+		Budget:               contextBudget,
+		MaxObservationTokens: maxObservationTokens,
+		Summarizer:           summarizer,
+	})
+
+	return &agent{
+		client:         client,
+		tracker:        tracker,
+		contextManager: contextManager,
+		session:        session,
+		model:          options.ModelOr(defaultModel),
+		temperature:    options.Temperature,
+		maxIter:        options.MaxIter,
+		tools:          options.Tools,
+		trace:          true,
+		out:            os.Stdout,
+		prompt:         prompt,
+	}
+}
+
+// completionParams builds the request for the configured model and temperature
+func (a *agent) completionParams(messages []openai.ChatCompletionMessageParamUnion) openai.ChatCompletionNewParams {
+	params := openai.ChatCompletionNewParams{
+		Messages: messages,
+		Model:    a.model,
+	}
+	if a.temperature != nil {
+		params.Temperature = openai.Float(*a.temperature)
+	}
+	return params
+}
+
+// toolEnabled reports whether the action may be run
+func (a *agent) toolEnabled(action string) bool {
+	return internal.RunOptions{Tools: a.tools}.ToolEnabled(action)
+}
+
+// enabledActions lists the actions that may be run
+func (a *agent) enabledActions() []actionSpec {
+	var enabled []actionSpec
+	for _, action := range actions {
+		if a.toolEnabled(action.Name) {
+			enabled = append(enabled, action)
+		}
+	}
+	return enabled
+}
+
+// runAction runs an enabled action and returns its observation, or a tool error
+func (a *agent) runAction(ctx context.Context, pages *internal.PageStore, action, actionInput string) (string, error) {
+	spec, ok := findAction(action)
+	if !ok {
+		return "", &internal.ToolError{Tool: action, Err: fmt.Errorf("unknown action %s", action)}
+	}
+	if !a.toolEnabled(action) {
+		return "", &internal.ToolError{Tool: action, Err: fmt.Errorf("action %s is disabled", action)}
+	}
+
+	observation, err := spec.run(ctx, pages, actionInput)
+	if err != nil {
+		return "", internal.NewToolError(action, err)
+	}
+	return observation, nil
+}
+
+// queryModel streams a query to the OpenAI API and returns the response.
+// A response cut off at the token limit is returned along with internal.ErrTruncated.
+func (a *agent) queryModel(ctx context.Context, step int, messages []openai.ChatCompletionMessageParamUnion, handler internal.StreamHandler) (string, error) {
+	chatCompletion, err := internal.StreamChatCompletion(
+		ctx,
+		a.client,
+		a.completionParams(messages),
+		handler,
+	)
+	fmt.Fprintln(a.out)
+
+	if err != nil {
+		return "", &internal.ModelError{Model: a.model, Step: step, Err: err}
+	}
+	a.tracker.RecordCompletion("agent", step, chatCompletion)
+
+	content, err := internal.CompletionContent(chatCompletion)
+	if err != nil {
+		return content, &internal.ModelError{Model: a.model, Step: step, Err: err}
+	}
+
+	return content, nil
+}
+
+// runAgentLoop executes the agent's thought-action-observation loop and returns the final response.
+// A run without an answer after maxIter iterations fails with internal.ErrMaxIterations.
+func (a *agent) runAgentLoop(ctx context.Context, userQuery string) (response string, err error) {
+	ctx, span := internal.StartSpan(ctx, internal.SpanRun, "react")
+	span.Input = userQuery
+	span.SetAttribute("model", a.model)
+	span.SetAttribute("session", a.session.ID)
+	span.SetAttribute("prompt", a.prompt.prompt.ID())
+	defer func() {
+		span.Output = response
+		span.Finish(err)
+	}()
+
+	// Earlier questions and answers of the session give context to follow-up questions
+	history, err := a.session.Recall(ctx)
+	if err != nil {
+		internal.Logger("agent").Warn("failed to recall session", "session", a.session.ID, "error", err)
+	}
+
+	// Scraped pages live outside the conversation and are read chunk by chunk
+	pages := internal.NewPageStore(pageChunkSize)
+
+	// System prompt and question are pinned, so compaction never drops them
+	systemPrompt, err := a.prompt.render(a.enabledActions())
+	if err != nil {
+		return "", err
+	}
+	messages := []internal.Message{{Role: "system", Content: systemPrompt, Pinned: true}}
+	messages = append(messages, history...)
+	messages = append(messages, internal.Message{Role: "user", Content: userQuery, Pinned: true})
+
+	// Only the question and the final response of a successful run are remembered, not the
+	// intermediate steps, so a failed run doesn't leave a half answer in the history
+	defer func() {
+		if err != nil {
+			return
+		}
+		err := a.session.Append(context.Background(),
+			internal.Message{Role: "user", Content: userQuery},
+			internal.Message{Role: "assistant", Content: response},
+		)
+		if err != nil {
+			internal.Logger("agent").Error("failed to save session", "session", a.session.ID, "error", err)
+		}
+	}()
+
+	// Every malformed response the model is asked to fix costs an iteration
+	var repairs repairer
+
+	for i := 0; i < a.maxIter; i++ {
+		if err := ctx.Err(); err != nil {
+			return response, err
+		}
+
+		internal.Logger("agent").Info("loop", "step", i+1)
+
+		messages = a.contextManager.Compact(ctx, messages)
+
+		response, err = a.queryModel(ctx, i+1, internal.ToOpenAI(messages), newPauseDetector(a.out))
+		if errors.Is(err, internal.ErrTruncated) {
+			// The action line usually comes early, so a cut off response is still worth using
+			internal.Logger("agent").Warn("using truncated response", "step", i+1, "error", err)
+		} else if err != nil {
+			return response, err
+		}
+		messages = append(messages, internal.Message{Role: "assistant", Content: response})
+
+		// A truncated response isn't repaired, its error ends the run
+		parsed, repair, parseErr := repairs.check(response, actionNames(actions), actionNames(a.enabledActions()))
+		if parseErr != nil && err == nil {
+			if repair == "" {
+				return response, parseErr
+			}
+
+			internal.Logger("agent").Warn("asking the model to fix its response", "step", i+1, "attempt", repairs.attempts, "error", parseErr)
+			messages = append(messages, internal.Message{Role: "user", Content: repair})
+			continue
+		}
+
+		if parsed == nil {
+			internal.Logger("agent").Info("no more actions, agent is done", "step", i+1)
+			// A truncated final answer is returned along with the error
+			return response, err
+		}
+
+		action := parsed.Name
+		actionInput := parsed.Input
+
+		toolCtx, toolSpan := internal.StartSpan(ctx, internal.SpanTool, action)
+		toolSpan.Input = actionInput
+		observation, toolErr := a.runAction(toolCtx, pages, action, actionInput)
+		a.tracker.RecordTool("agent", action, time.Since(toolSpan.Start))
+		toolSpan.Output = observation
+		toolSpan.Finish(toolErr)
+
+		if toolErr != nil {
+			if internal.IsFatal(toolErr) {
+				return response, toolErr
+			}
+			// Recoverable errors are shown to the model, so it can try something else
+			var recoverable *internal.ToolError
+			errors.As(toolErr, &recoverable)
+			observation = recoverable.Observation()
+		}
+
+		// Oversized observations (e.g. scraped pages) are summarized or truncated
+		observation = a.contextManager.FitObservation(ctx, observation)
+		if a.trace {
+			internal.Logger("agent").Info("observation", "action", action, "observation", observation)
+		}
+
+		// Add observation to messages
+		messages = append(messages, internal.Message{Role: "user", Content: fmt.Sprintf("Observation: %s", observation)})
+	}
+
+	if err := ctx.Err(); err != nil {
+		return response, err
+	}
+	// The last response is an intermediate step, not an answer
+	return response, fmt.Errorf("%w of %d", internal.ErrMaxIterations, a.maxIter)
+}
+
+// runREPL runs the agent interactively until the user quits
+func runREPL(ctx context.Context, a *agent) error {
+	repl := internal.NewREPL("agent> ", func(ctx context.Context, input string) error {
+		_, err := a.runAgentLoop(ctx, input)
+		return err
+	})
+
+	repl.AddCommand(internal.Command{
+		Name:        "reset",
+		Usage:       "/reset",
+		Description: "Start a new session",
+		Run: func(ctx context.Context, args []string) error {
+			a.session.Reset()
+			fmt.Printf("Session: %s\n", a.session.ID)
+			return nil
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "tools",
+		Usage:       "/tools",
+		Description: "List available actions",
+		Run: func(ctx context.Context, args []string) error {
+			for _, action := range a.enabledActions() {
+				fmt.Printf("%s: %s\n  %s\n", action.Name, action.Args, action.Description)
+			}
+			return nil
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "model",
+		Usage:       "/model [name]",
+		Description: "Show or change the model",
+		Run: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				a.model = args[0]
+			}
+			fmt.Printf("Model: %s\n", a.model)
+			return nil
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "cost",
+		Usage:       "/cost",
+		Description: "Show token usage and cost so far",
+		Run: func(ctx context.Context, args []string) error {
+			a.tracker.PrintSummary(os.Stdout)
+			return nil
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "save",
+		Usage:       "/save <file>",
+		Description: "Save the session to a file",
+		Run: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("usage: /save <file>")
+			}
+			return a.session.Export(ctx, args[0])
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "load",
+		Usage:       "/load <file>",
+		Description: "Continue a session saved with /save",
+		Run: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("usage: /load <file>")
+			}
+			if err := a.session.Import(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Session: %s\n", a.session.ID)
+			return nil
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "trace",
+		Usage:       "/trace",
+		Description: "Toggle printing of tool observations",
+		Run: func(ctx context.Context, args []string) error {
+			a.trace = !a.trace
+			fmt.Printf("Trace: %v\n", a.trace)
+			return nil
+		},
+	})
+
+	return repl.Run(ctx)
+}
+
+// Run answers the queries with the agent loop, or starts a REPL in interactive mode
+func Run(ctx context.Context, options internal.RunOptions) error {
+	client := internal.NewOpenAIClient()
+	tracker, err := internal.NewUsageTrackerFromEnv()
+	if err != nil {
+		return fmt.Errorf("error loading price table: %w", err)
+	}
+	tokenizer := internal.NewTokenizer(options.ModelOr(defaultModel))
+	summarizer := internal.NewOpenAISummarizer(client, "gpt-4o-mini", tracker)
+
+	store, err := internal.NewSessionStoreFromEnv()
+	if err != nil {
+		return fmt.Errorf("error opening session store: %w", err)
+	}
+	session := internal.NewSessionFromEnv(store, tokenizer, summarizer)
+	internal.Logger("agent").Info("session started, set SESSION_ID to resume it", "session", session.ID)
+
+	prompt, err := loadPromptTemplate()
+	if err != nil {
+		return err
+	}
+
+	a := newAgent(client, tracker, tokenizer, session, prompt, options)
+	a.out = options.Console()
+
+	if options.Interactive {
+		if err := runREPL(ctx, a); err != nil {
+			return err
+		}
+	} else {
+		for i, query := range options.QueriesOr(defaultQueries...) {
+			internal.Logger("agent").Info("running query", "index", i+1, "query", query)
+
+			result := internal.RunResult{Query: query}
+			answer, err := a.runAgentLoop(ctx, query)
+			if err != nil {
+				result.Error = err.Error()
+			}
+			result.Answer = answer
+
+			internal.PrintResult(os.Stdout, options.Output, result)
+		}
+	}
+
+	tracker.PrintSummary(options.Console())
+	if err := tracker.WriteReport("usage_report.json"); err != nil {
+		return fmt.Errorf("error writing usage report: %w", err)
+	}
+
+	return nil
+}
+
+// NewAnswerer returns an answerer running every query in a fresh agent without session history.
+// Streamed output and traces are not printed, as concurrent runs would interleave.
+func NewAnswerer(ctx context.Context, options internal.RunOptions) (internal.Answerer, error) {
+	client := internal.NewOpenAIClient()
+	tracker, err := internal.NewUsageTrackerFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("error loading price table: %w", err)
+	}
+	tokenizer := internal.NewTokenizer(options.ModelOr(defaultModel))
+	prompt, err := loadPromptTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, query string) (internal.Answer, error) {
+		queryTracker := tracker.Fork()
+		session := internal.NewSession(internal.NewSessionID(), internal.NewMemorySessionStore(), internal.BufferStrategy{})
+
+		a := newAgent(client, queryTracker, tokenizer, session, prompt, options)
+		a.trace = false
+		a.out = io.Discard
+
+		text, err := a.runAgentLoop(ctx, query)
+		report := queryTracker.Report()
+
+		return internal.Answer{
+			Text:  text,
+			Steps: report.ByAgent["agent"].Calls,
+			Usage: report.Total,
+		}, err
+	}, nil
+}
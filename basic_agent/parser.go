@@ -0,0 +1,172 @@
+package basicagent
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxRepairAttempts is how many malformed responses in a row the model gets to fix before the run fails
+const maxRepairAttempts = 2
+
+// errMalformedOutput is returned by parseAction for responses that follow neither the Action nor the Answer format
+var errMalformedOutput = errors.New("malformed model output")
+
+var (
+	// actionLineRegex matches an Action line, ignoring case, spacing and markdown emphasis, e.g. "**action** : ping: wolt.com"
+	actionLineRegex = regexp.MustCompile(`(?i)^[*_\s]*action[*_\s]*:[*_\s]*(.*)$`)
+	// actionInputRegex matches a separate input line, e.g. "Action Input: wolt.com"
+	actionInputRegex = regexp.MustCompile(`(?i)^[*_\s]*action[ _]input[*_\s]*:\s*(.*)$`)
+	// stopLineRegex matches the lines that end a multi-line action input
+	stopLineRegex = regexp.MustCompile(`(?i)^[*_\s]*(pause|observation|thought|answer)[*_\s]*(:|$)`)
+	// answerLineRegex matches the final Answer line
+	answerLineRegex = regexp.MustCompile(`(?i)^[*_\s]*answer[*_\s]*:`)
+	// fenceRegex matches a markdown code fence line, e.g. "```bash"
+	fenceRegex = regexp.MustCompile("^\\s*```[\\w-]*\\s*$")
+)
+
+// parsedAction is an action requested by the model
+type parsedAction struct {
+	Name  string
+	Input string
+}
+
+// parseAction finds the first action in a model response. It returns nil without an error if the
+// response is a final Answer, and an error wrapping errMalformedOutput if it's neither.
+func parseAction(response string, actions []string) (*parsedAction, error) {
+	lines := strings.Split(response, "\n")
+
+	for i, line := range lines {
+		matches := actionLineRegex.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		name, input, ok := splitAction(strings.TrimSpace(matches[1]), actions)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown action in %q", errMalformedOutput, strings.TrimSpace(line))
+		}
+		// Drop the closing emphasis of a fully emphasized line, e.g. "**Action: ping: wolt.com**"
+		if strings.HasPrefix(strings.TrimSpace(line), "**") {
+			input = strings.TrimSpace(strings.TrimSuffix(input, "**"))
+		}
+
+		// The input may continue on the following lines, e.g. in a code block, or be given as "Action Input:"
+		var rest []string
+		for _, next := range lines[i+1:] {
+			if stopLineRegex.MatchString(next) {
+				break
+			}
+			if fenceRegex.MatchString(next) {
+				continue
+			}
+			if inputMatches := actionInputRegex.FindStringSubmatch(next); inputMatches != nil {
+				next = inputMatches[1]
+			}
+			rest = append(rest, next)
+		}
+		if extra := strings.TrimSpace(strings.Join(rest, "\n")); extra != "" {
+			if input == "" {
+				input = extra
+			} else {
+				input += "\n" + extra
+			}
+		}
+
+		input = unquote(input)
+		if input == "" {
+			return nil, fmt.Errorf("%w: action %s has no input", errMalformedOutput, name)
+		}
+
+		return &parsedAction{Name: name, Input: input}, nil
+	}
+
+	for _, line := range lines {
+		if answerLineRegex.MatchString(line) {
+			return nil, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no Action or Answer found", errMalformedOutput)
+}
+
+// splitAction separates a known action name from its input, accepting e.g.
+// "web_search: x", "Web Search: x", "web-search x" and "web_search(x)"
+func splitAction(text string, actions []string) (name, input string, ok bool) {
+	// Longer names first, so a name that is a prefix of another one doesn't shadow it
+	sorted := append([]string(nil), actions...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	text = strings.TrimLeft(text, "`*_")
+	lower := strings.ToLower(text)
+	for _, action := range sorted {
+		for _, form := range []string{action, strings.ReplaceAll(action, "_", " "), strings.ReplaceAll(action, "_", "-"), strings.ReplaceAll(action, "_", "")} {
+			if !strings.HasPrefix(lower, form) {
+				continue
+			}
+
+			rest := text[len(form):]
+			rest = strings.TrimLeft(rest, "`*_")
+			switch {
+			case rest == "":
+				return action, "", true
+			case strings.HasPrefix(rest, "(") && strings.HasSuffix(rest, ")"):
+				return action, strings.TrimSpace(rest[1 : len(rest)-1]), true
+			case strings.HasPrefix(rest, ":"), strings.HasPrefix(rest, " "), strings.HasPrefix(rest, "\t"):
+				return action, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest), ":")), true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// unquote strips quotes or backticks wrapped around the whole input
+func unquote(input string) string {
+	input = strings.TrimSpace(input)
+	for _, quote := range []string{`"`, "'", "`"} {
+		if len(input) >= 2 && strings.HasPrefix(input, quote) && strings.HasSuffix(input, quote) {
+			return strings.TrimSpace(input[1 : len(input)-1])
+		}
+	}
+	return input
+}
+
+// repairer counts the malformed responses in a row, the model gets to fix maxRepairAttempts of them
+type repairer struct {
+	attempts int
+}
+
+// check parses a response against the actions. A malformed one returns its error along with the
+// prompt asking the model to fix it with one of the enabled actions, or without one once no
+// attempts are left.
+func (r *repairer) check(response string, actions, enabled []string) (parsed *parsedAction, repair string, err error) {
+	parsed, err = parseAction(response, actions)
+	if err == nil {
+		if parsed != nil {
+			r.attempts = 0
+		}
+		return parsed, "", nil
+	}
+
+	if r.attempts == maxRepairAttempts {
+		return nil, "", fmt.Errorf("%w after %d repair attempts", err, r.attempts)
+	}
+	r.attempts++
+	return nil, repairPrompt(err, enabled), err
+}
+
+// repairPrompt tells the model why its response couldn't be used and how to fix it
+func repairPrompt(err error, actions []string) string {
+	return fmt.Sprintf(`Your last response could not be used (%v).
+Reply in exactly one of these formats:
+
+Action: <action>: <input>
+Pause
+
+Answer: <your final answer>
+
+Valid actions: %s`, err, strings.Join(actions, ", "))
+}
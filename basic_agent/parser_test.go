@@ -0,0 +1,221 @@
+package basicagent
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testActions are the actions the test responses may use
+var testActions = []string{"ping", "bash", "web_search", "scrape", "read_chunk", "find_in_page"}
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		// want is the parsed action, nil for an answer or a malformed response
+		want *parsedAction
+		// err is part of the expected error, empty if the response is well formed
+		err string
+	}{
+		{
+			name:     "plain",
+			response: "Thought: I should ping it\nAction: ping: wolt.com\nPAUSE",
+			want:     &parsedAction{Name: "ping", Input: "wolt.com"},
+		},
+		{
+			name:     "answer",
+			response: "Thought: I know it now\nAnswer: The response time is 0.02 seconds",
+		},
+		{
+			name:     "emphasized",
+			response: "**Action**: ping: wolt.com\nPause",
+			want:     &parsedAction{Name: "ping", Input: "wolt.com"},
+		},
+		{
+			name:     "fully emphasized",
+			response: "**Action: ping: wolt.com**",
+			want:     &parsedAction{Name: "ping", Input: "wolt.com"},
+		},
+		{
+			name:     "spaced name",
+			response: "action : Web Search: golang release notes",
+			want:     &parsedAction{Name: "web_search", Input: "golang release notes"},
+		},
+		{
+			name:     "dashed name without colon",
+			response: "Action: web-search golang",
+			want:     &parsedAction{Name: "web_search", Input: "golang"},
+		},
+		{
+			name:     "call syntax",
+			response: "Action: find_in_page(p1: latency)",
+			want:     &parsedAction{Name: "find_in_page", Input: "p1: latency"},
+		},
+		{
+			name:     "quoted input",
+			response: "Action: ping: \"wolt.com\"",
+			want:     &parsedAction{Name: "ping", Input: "wolt.com"},
+		},
+		{
+			name:     "backticked input",
+			response: "Action: `bash`: `go version`",
+			want:     &parsedAction{Name: "bash", Input: "go version"},
+		},
+		{
+			name:     "fenced input",
+			response: "Action: bash:\n```bash\ngo version\nuname -a\n```\nPAUSE",
+			want:     &parsedAction{Name: "bash", Input: "go version\nuname -a"},
+		},
+		{
+			name:     "action input line",
+			response: "Action: scrape\nAction Input: https://wolt.com\nPAUSE",
+			want:     &parsedAction{Name: "scrape", Input: "https://wolt.com"},
+		},
+		{
+			name:     "input continues until observation",
+			response: "Action: bash: echo one\necho two\nObservation: made up",
+			want:     &parsedAction{Name: "bash", Input: "echo one\necho two"},
+		},
+		{
+			name:     "multiple actions take the first",
+			response: "Action: ping: wolt.com\nPAUSE\nAction: ping: google.com\nPAUSE",
+			want:     &parsedAction{Name: "ping", Input: "wolt.com"},
+		},
+		{
+			name:     "action before answer",
+			response: "Action: ping: wolt.com\nPAUSE\nAnswer: 0.02 seconds",
+			want:     &parsedAction{Name: "ping", Input: "wolt.com"},
+		},
+		{
+			name:     "longer name wins",
+			response: "Action: read_chunk: p1#2",
+			want:     &parsedAction{Name: "read_chunk", Input: "p1#2"},
+		},
+		{
+			name:     "missing input",
+			response: "Action: ping\nPAUSE",
+			err:      "action ping has no input",
+		},
+		{
+			name:     "empty quoted input",
+			response: "Action: ping: \"\"",
+			err:      "action ping has no input",
+		},
+		{
+			name:     "unknown action",
+			response: "Action: traceroute: wolt.com",
+			err:      `unknown action in "Action: traceroute: wolt.com"`,
+		},
+		{
+			name:     "no action or answer",
+			response: "I think the site is fast.",
+			err:      "no Action or Answer found",
+		},
+		{
+			name:     "empty",
+			response: "",
+			err:      "no Action or Answer found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAction(tt.response, testActions)
+
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("parseAction() error = %v, want none", err)
+				}
+			} else {
+				if !errors.Is(err, errMalformedOutput) || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("parseAction() error = %v, want a malformed output error containing %q", err, tt.err)
+				}
+			}
+
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || *got != *tt.want:
+				t.Errorf("parseAction() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepairer(t *testing.T) {
+	const (
+		action    = "Action: ping: wolt.com\nPAUSE"
+		answer    = "Answer: 0.02 seconds"
+		malformed = "The site is fast."
+	)
+
+	tests := []struct {
+		name      string
+		responses []string
+		// repairs are the responses that get a repair prompt, by index
+		repairs []int
+		// failed is the index of the response that ends the run, -1 if none does
+		failed int
+	}{
+		{
+			name:      "well formed",
+			responses: []string{action, action, answer},
+			failed:    -1,
+		},
+		{
+			name:      "repaired",
+			responses: []string{malformed, action, answer},
+			repairs:   []int{0},
+			failed:    -1,
+		},
+		{
+			name:      "attempts used up",
+			responses: []string{malformed, malformed, malformed},
+			repairs:   []int{0, 1},
+			failed:    2,
+		},
+		{
+			name:      "action resets the attempts",
+			responses: []string{malformed, malformed, action, malformed, malformed, answer},
+			repairs:   []int{0, 1, 3, 4},
+			failed:    -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var repairs repairer
+			var repaired []int
+			failed := -1
+
+			for i, response := range tt.responses {
+				parsed, repair, err := repairs.check(response, testActions, []string{"ping"})
+				switch {
+				case repair != "":
+					if err == nil {
+						t.Fatalf("response %d: check() returned a repair prompt without the error", i)
+					}
+					if !strings.Contains(repair, err.Error()) || !strings.Contains(repair, "Valid actions: ping") {
+						t.Errorf("response %d: repair prompt %q doesn't explain %v with the enabled actions", i, repair, err)
+					}
+					repaired = append(repaired, i)
+				case err != nil:
+					if !errors.Is(err, errMalformedOutput) || !strings.Contains(err.Error(), "after 2 repair attempts") {
+						t.Errorf("response %d: check() error = %v, want a malformed output error after 2 repair attempts", i, err)
+					}
+					failed = i
+				case response == action && parsed == nil:
+					t.Errorf("response %d: check() parsed no action", i)
+				}
+				if failed >= 0 {
+					break
+				}
+			}
+
+			if !slices.Equal(repaired, tt.repairs) || failed != tt.failed {
+				t.Errorf("repaired %v and failed at %d, want %v and %d", repaired, failed, tt.repairs, tt.failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package basicagent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+)
+
+// defaultExample is the few-shot example used when no example files are given
+const defaultExample = `Question: How many islands make up Madeira?
+Thought: I should do a web search for the Madeira
+Action: web_search: Madeira
+Pause
+
+You will be called again with this:
+Observation: Madeira is a Portuguese island chain made up of four islands: Madeira, Porto Santo, Desertas, and Selvagens, only two of which are inhabited (Madeira and Porto Santo.)
+
+You then output:
+Answer: Four islands`
+
+// promptTemplate renders the system prompt from the react prompt of the prompt library
+type promptTemplate struct {
+	prompt   *internal.Prompt
+	examples []string
+}
+
+// loadPromptTemplate loads the react prompt and the few-shot examples from the files in AGENT_EXAMPLES,
+// falling back to the built-in example if it's not set
+func loadPromptTemplate() (*promptTemplate, error) {
+	library, err := internal.LoadPrompts()
+	if err != nil {
+		return nil, err
+	}
+	prompt, err := library.Get("react")
+	if err != nil {
+		return nil, err
+	}
+
+	examples := []string{defaultExample}
+	if dir := os.Getenv("AGENT_EXAMPLES"); dir != "" {
+		examples, err = loadExamples(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &promptTemplate{prompt: prompt, examples: examples}, nil
+}
+
+// loadExamples reads every .txt file in dir as an example session, in file name order
+func loadExamples(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list examples: %w", err)
+	}
+	sort.Strings(paths)
+
+	var examples []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read example: %w", err)
+		}
+		examples = append(examples, strings.TrimSpace(string(data)))
+	}
+
+	return examples, nil
+}
+
+// render returns the system prompt describing the given actions
+func (p *promptTemplate) render(actions []actionSpec) (string, error) {
+	vars := internal.PromptVars(actionNames(actions))
+	vars["Actions"] = actions
+	vars["Examples"] = p.examples
+
+	return p.prompt.Render(vars)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/RB387/wolt-ai-agents-talk/baseline"
+	basicagent "github.com/RB387/wolt-ai-agents-talk/basic_agent"
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	llmchain "github.com/RB387/wolt-ai-agents-talk/llm_chain"
+	mcpserver "github.com/RB387/wolt-ai-agents-talk/mcp"
+	multiagent "github.com/RB387/wolt-ai-agents-talk/multi_agent"
+	"github.com/spf13/cobra"
+)
+
+// logOptions are read from the environment and overridden by the root command's flags
+var logOptions = internal.LogOptionsFromEnv()
+
+// runFlags are the flags shared by all agent subcommands
+type runFlags struct {
+	queries     []string
+	queriesFile string
+	model       string
+	temperature float64
+	maxIter     int
+	tools       []string
+	output      string
+	interactive bool
+}
+
+func (f *runFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&f.queries, "query", "q", nil, "query to run, can be repeated")
+	cmd.Flags().StringVarP(&f.queriesFile, "queries-file", "f", "", "file with one query per line")
+	cmd.Flags().StringVarP(&f.model, "model", "m", "", "model to use instead of the default one")
+	cmd.Flags().Float64VarP(&f.temperature, "temperature", "t", 0, "sampling temperature")
+	cmd.Flags().IntVar(&f.maxIter, "max-iter", 5, "maximum agent loop iterations")
+	cmd.Flags().StringSliceVar(&f.tools, "tools", nil, "comma separated list of enabled tools (default all)")
+	cmd.Flags().StringVarP(&f.output, "output", "o", "text", "output format: text or json")
+	cmd.Flags().BoolVarP(&f.interactive, "interactive", "i", false, "start an interactive session")
+}
+
+// options converts the parsed flags into run options
+func (f *runFlags) options(cmd *cobra.Command) (internal.RunOptions, error) {
+	if f.output != "text" && f.output != "json" {
+		return internal.RunOptions{}, fmt.Errorf("unknown output format: %s", f.output)
+	}
+
+	options := internal.RunOptions{
+		Queries:     f.queries,
+		Model:       f.model,
+		MaxIter:     f.maxIter,
+		Tools:       f.tools,
+		Output:      f.output,
+		Interactive: f.interactive,
+		Quiet:       logOptions.Quiet,
+	}
+
+	// Only send a temperature if it was asked for, so the provider default applies otherwise
+	if cmd.Flags().Changed("temperature") {
+		options.Temperature = &f.temperature
+	}
+
+	if f.queriesFile != "" {
+		queries, err := internal.LoadQueries(f.queriesFile)
+		if err != nil {
+			return internal.RunOptions{}, err
+		}
+		options.Queries = append(options.Queries, queries...)
+	}
+
+	return options, nil
+}
+
+// agentCommand creates a subcommand running one of the agent variants
+func agentCommand(use, short string, run func(context.Context, internal.RunOptions) error) *cobra.Command {
+	var flags runFlags
+
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options, err := flags.options(cmd)
+			if err != nil {
+				return err
+			}
+			return run(cmd.Context(), options)
+		},
+	}
+	flags.register(cmd)
+
+	return cmd
+}
+
+// answerers create single query runners for the agent variants, by subcommand name
+var answerers = map[string]func(context.Context, internal.RunOptions) (internal.Answerer, error){
+	"baseline":  baseline.NewAnswerer,
+	"react":     basicagent.NewAnswerer,
+	"langchain": llmchain.NewAnswerer,
+	"swarm":     multiagent.NewAnswerer,
+}
+
+// batchCommand creates the subcommand answering a file of queries with one of the single agent variants
+func batchCommand() *cobra.Command {
+	var (
+		model       string
+		temperature float64
+		maxIter     int
+		tools       []string
+		variant     string
+		input       string
+		output      string
+		concurrency int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "batch",
+		Short: "Answer queries from a JSONL or CSV file and write JSONL results, resuming where a previous run stopped",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options := internal.RunOptions{Model: model, MaxIter: maxIter, Tools: tools}
+			if cmd.Flags().Changed("temperature") {
+				options.Temperature = &temperature
+			}
+
+			newAnswerer, ok := answerers[variant]
+			if !ok {
+				return fmt.Errorf("unknown agent variant: %s", variant)
+			}
+			answerer, err := newAnswerer(cmd.Context(), options)
+			if err != nil {
+				return err
+			}
+
+			queries, err := internal.LoadBatchQueries(input)
+			if err != nil {
+				return err
+			}
+
+			return internal.RunBatch(cmd.Context(), queries, output, concurrency, answerer)
+		},
+	}
+
+	cmd.Flags().StringVarP(&model, "model", "m", "", "model to use instead of the default one")
+	cmd.Flags().Float64VarP(&temperature, "temperature", "t", 0, "sampling temperature")
+	cmd.Flags().IntVar(&maxIter, "max-iter", 5, "maximum agent loop iterations")
+	cmd.Flags().StringSliceVar(&tools, "tools", nil, "comma separated list of enabled tools (default all)")
+	cmd.Flags().StringVarP(&variant, "agent", "a", "react", "agent variant: baseline, react, langchain or swarm")
+	cmd.Flags().StringVarP(&input, "input", "f", "", "JSONL or CSV file with the queries")
+	cmd.Flags().StringVarP(&output, "output", "o", "results.jsonl", "JSONL file the results are appended to")
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "c", 4, "number of queries run in parallel")
+	cmd.MarkFlagRequired("input")
+
+	return cmd
+}
+
+// evalCommand creates the subcommand grading agent variants on a dataset
+func evalCommand() *cobra.Command {
+	var (
+		model      string
+		maxIter    int
+		dataset    string
+		variants   []string
+		judgeModel string
+		report     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "eval",
+		Short: "Grade agent variants on a JSONL dataset and compare accuracy, steps, cost and latency",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cases, err := internal.LoadEvalDataset(dataset)
+			if err != nil {
+				return err
+			}
+
+			var evalVariants []internal.EvalVariant
+			for _, name := range variants {
+				newAnswerer, ok := answerers[name]
+				if !ok {
+					return fmt.Errorf("unknown agent variant: %s", name)
+				}
+				evalVariants = append(evalVariants, internal.EvalVariant{Name: name, New: newAnswerer})
+			}
+
+			judgeTracker, err := internal.NewUsageTrackerFromEnv()
+			if err != nil {
+				return fmt.Errorf("error loading price table: %w", err)
+			}
+			judge := internal.NewLLMJudge(internal.NewOpenAIClient(), judgeModel, judgeTracker)
+
+			options := internal.RunOptions{Model: model, MaxIter: maxIter}
+			result, err := internal.NewEvaluator(options, judge).Run(cmd.Context(), cases, evalVariants)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println()
+			result.PrintTable(os.Stdout)
+			fmt.Printf("\nJudge cost: $%.4f\n", judgeTracker.Report().Total.Cost)
+
+			return result.WriteReport(report)
+		},
+	}
+
+	cmd.Flags().StringVarP(&dataset, "dataset", "d", "", "JSONL dataset with question, expected or rubric, grader and tools per line")
+	cmd.Flags().StringSliceVarP(&variants, "agents", "a", []string{"baseline", "react", "langchain", "swarm"}, "agent variants to compare")
+	cmd.Flags().StringVarP(&model, "model", "m", "", "model to use instead of each variant's default one")
+	cmd.Flags().IntVar(&maxIter, "max-iter", 5, "maximum agent loop iterations")
+	cmd.Flags().StringVar(&judgeModel, "judge-model", "gpt-4o-mini", "model grading answers of llm graded cases")
+	cmd.Flags().StringVarP(&report, "report", "r", "eval_report.json", "file the JSON report is written to")
+	cmd.MarkFlagRequired("dataset")
+
+	return cmd
+}
+
+// traceCommand creates the subcommand rendering saved traces as an HTML page
+func traceCommand() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "trace <trace.jsonl> [other.jsonl...]",
+		Short: "Render traces saved with TRACE_FILE as an HTML page, with diffs between runs of the same query",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := internal.RenderTraceFiles(output, args...); err != nil {
+				return err
+			}
+			fmt.Printf("Trace written to %s\n", output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "trace.html", "HTML file to write")
+
+	return cmd
+}
+
+// graphCommand creates the subcommand exporting the swarm workflow as a graph
+func graphCommand() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Print the swarm workflow at WORKFLOW_FILE as a Mermaid or DOT graph",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			graph, err := multiagent.ExportGraph(format)
+			if err != nil {
+				return err
+			}
+			fmt.Print(graph)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "mermaid", "graph format: mermaid or dot")
+
+	return cmd
+}
+
+// resumeCommand creates the subcommand continuing a checkpointed swarm run, or listing the runs
+func resumeCommand() *cobra.Command {
+	var (
+		step   int
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "resume [run-id]",
+		Short: "Continue a checkpointed swarm run from its last checkpoint or a chosen step, or list the runs",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return multiagent.ListRuns(os.Stdout)
+			}
+			if output != "text" && output != "json" {
+				return fmt.Errorf("unknown output format: %s", output)
+			}
+			return multiagent.Resume(cmd.Context(), args[0], step, internal.RunOptions{Output: output, Quiet: logOptions.Quiet})
+		},
+	}
+
+	cmd.Flags().IntVar(&step, "step", -1, "step to continue from (default the last checkpoint)")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "output format: text or json")
+
+	return cmd
+}
+
+func main() {
+	root := &cobra.Command{
+		Use:          "agents",
+		Short:        "LLM agents from a vanilla model to multi-agent systems",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return internal.SetupLogging(os.Stderr, logOptions)
+		},
+	}
+	root.PersistentFlags().StringVar(&logOptions.Level, "log-level", logOptions.Level, "log level: debug, info, warn or error (default info)")
+	root.PersistentFlags().StringVar(&logOptions.Format, "log-format", logOptions.Format, "log format: text or json (default text)")
+	root.PersistentFlags().BoolVar(&logOptions.Quiet, "quiet", logOptions.Quiet, "only log errors and print nothing but the results to stdout")
+
+	root.AddCommand(
+		agentCommand("baseline", "Query the model directly, without any tools", baseline.Run),
+		agentCommand("react", "Run the ReAct agent written from scratch", basicagent.Run),
+		agentCommand("langchain", "Run the ReAct agent built with langchaingo", llmchain.Run),
+		agentCommand("swarm", "Run the supervisor, writer and scraper multi-agent workflow", multiagent.Run),
+		batchCommand(),
+		evalCommand(),
+		traceCommand(),
+		graphCommand(),
+		resumeCommand(),
+		&cobra.Command{
+			Use:   "mcp",
+			Short: "Serve package documentation over MCP on stdio",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return mcpserver.Serve()
+			},
+		},
+	)
+
+	tracer, err := internal.NewTracerFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = root.ExecuteContext(internal.ContextWithTracer(context.Background(), tracer))
+	if closeErr := tracer.Close(); closeErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", closeErr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,17 @@
+// Command docs-mcp serves package documentation over MCP on stdio, like agents mcp, for IDEs
+// configured with a binary of its own
+package main
+
+import (
+	"fmt"
+	"os"
+
+	mcpserver "github.com/RB387/wolt-ai-agents-talk/mcp"
+)
+
+func main() {
+	if err := mcpserver.Serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,58 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Checkpoint is the state of a run after a step and the nodes it continues with
+type Checkpoint[S any] struct {
+	Step int       `json:"step"`
+	Time time.Time `json:"time"`
+	// Nodes ran in this step
+	Nodes []string `json:"nodes"`
+	State S        `json:"state"`
+	// Next are the nodes of the next step, none once the run finished
+	Next []string `json:"next"`
+	// Waiting holds the nodes each join got so far
+	Waiting map[string][]string `json:"waiting,omitempty"`
+}
+
+// Checkpointer saves the checkpoints of a run
+type Checkpointer[S any] interface {
+	Save(ctx context.Context, checkpoint Checkpoint[S]) error
+}
+
+// MemoryCheckpointer keeps the checkpoints of a run in memory
+type MemoryCheckpointer[S any] struct {
+	mu          sync.Mutex
+	checkpoints []Checkpoint[S]
+}
+
+func (c *MemoryCheckpointer[S]) Save(ctx context.Context, checkpoint Checkpoint[S]) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkpoints = append(c.checkpoints, checkpoint)
+	return nil
+}
+
+// Checkpoints returns the checkpoints saved so far
+func (c *MemoryCheckpointer[S]) Checkpoints() []Checkpoint[S] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Checkpoint[S](nil), c.checkpoints...)
+}
+
+// Last returns the latest checkpoint, to resume the run from
+func (c *MemoryCheckpointer[S]) Last() (Checkpoint[S], bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.checkpoints) == 0 {
+		return Checkpoint[S]{}, false
+	}
+	return c.checkpoints[len(c.checkpoints)-1], true
+}
@@ -0,0 +1,130 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// start is the name of the entry point in exported graphs
+	start = "__start__"
+	// anyNode is the target of conditional edges without routes, they may lead to any node
+	anyNode = "*"
+)
+
+// exportEdge is an edge of the exported graph. Conditional edges are labelled with their route.
+type exportEdge struct {
+	from, to, label string
+	conditional     bool
+	join            bool
+}
+
+// exportEdges lists the edges in a stable order: from the entry point, then by node
+func (g *Graph[S]) exportEdges() []exportEdge {
+	edges := []exportEdge{{from: start, to: g.start}}
+
+	for _, from := range g.order {
+		for _, to := range g.edges[from] {
+			edges = append(edges, exportEdge{from: from, to: to, join: slices.Contains(g.joins[to], from)})
+		}
+
+		conditional, ok := g.conditionals[from]
+		if !ok {
+			continue
+		}
+		if conditional.routes == nil {
+			edges = append(edges, exportEdge{from: from, to: anyNode, conditional: true})
+			continue
+		}
+		for _, route := range sortedKeys(conditional.routes) {
+			edges = append(edges, exportEdge{from: from, to: conditional.routes[route], label: route, conditional: true})
+		}
+	}
+
+	return edges
+}
+
+// Mermaid exports the graph as a Mermaid flowchart. Conditional edges are dotted and
+// labelled with their route, edges into joins are thick.
+func (g *Graph[S]) Mermaid() string {
+	var out strings.Builder
+	out.WriteString("flowchart TD\n")
+	fmt.Fprintf(&out, "    %s([start])\n", start)
+	for _, name := range g.order {
+		fmt.Fprintf(&out, "    %s[%q]\n", mermaidID(name), name)
+	}
+	fmt.Fprintf(&out, "    %s([end])\n", End)
+
+	edges := g.exportEdges()
+	if slices.ContainsFunc(edges, func(edge exportEdge) bool { return edge.to == anyNode }) {
+		fmt.Fprintf(&out, "    %s{{any node}}\n", mermaidID(anyNode))
+	}
+
+	for _, edge := range edges {
+		arrow := "-->"
+		switch {
+		case edge.conditional && edge.label != "":
+			arrow = fmt.Sprintf("-. %s .->", edge.label)
+		case edge.conditional:
+			arrow = "-.->"
+		case edge.join:
+			arrow = "==>"
+		}
+		fmt.Fprintf(&out, "    %s %s %s\n", mermaidID(edge.from), arrow, mermaidID(edge.to))
+	}
+
+	return out.String()
+}
+
+// mermaidID turns a node name into an id Mermaid accepts
+func mermaidID(name string) string {
+	if name == anyNode {
+		return "__any__"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// DOT exports the graph in Graphviz's DOT language. Conditional edges are dashed and
+// labelled with their route, edges into joins are bold.
+func (g *Graph[S]) DOT() string {
+	var out strings.Builder
+	out.WriteString("digraph workflow {\n")
+	fmt.Fprintf(&out, "    %q [shape=oval label=\"start\"];\n", start)
+	for _, name := range g.order {
+		fmt.Fprintf(&out, "    %q [shape=box];\n", name)
+	}
+	fmt.Fprintf(&out, "    %q [shape=oval label=\"end\"];\n", End)
+
+	edges := g.exportEdges()
+	if slices.ContainsFunc(edges, func(edge exportEdge) bool { return edge.to == anyNode }) {
+		fmt.Fprintf(&out, "    %q [shape=diamond label=\"any node\"];\n", anyNode)
+	}
+
+	for _, edge := range edges {
+		var attrs []string
+		if edge.conditional {
+			attrs = append(attrs, "style=dashed")
+		}
+		if edge.label != "" {
+			attrs = append(attrs, fmt.Sprintf("label=%q", edge.label))
+		}
+		if edge.join {
+			attrs = append(attrs, "style=bold")
+		}
+
+		fmt.Fprintf(&out, "    %q -> %q", edge.from, edge.to)
+		if len(attrs) > 0 {
+			fmt.Fprintf(&out, " [%s]", strings.Join(attrs, " "))
+		}
+		out.WriteString(";\n")
+	}
+
+	out.WriteString("}\n")
+	return out.String()
+}
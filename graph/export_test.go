@@ -0,0 +1,56 @@
+package graph
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// exportGraph has every kind of edge: plain, into a join, routed and conditional without routes
+func exportGraph() *Graph[trail] {
+	g := New[trail]()
+	for _, name := range []string{"plan", "search web", "search docs", "write", "review", "ask"} {
+		g.AddNode(name, visit(name))
+	}
+	g.AddEdge("plan", "search web")
+	g.AddEdge("plan", "search docs")
+	g.AddJoin([]string{"search web", "search docs"}, "write")
+	g.AddEdge("write", "review")
+	g.AddConditionalEdges("review", routeTo("approve"), map[string]string{"approve": End, "revise": "write"})
+	g.AddConditionalEdges("ask", routeTo(End), nil)
+	g.SetMerge(mergeTrails)
+	return g
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		golden string
+		export func(g *Graph[trail]) string
+	}{
+		{golden: "graph.mmd", export: (*Graph[trail]).Mermaid},
+		{golden: "graph.dot", export: (*Graph[trail]).DOT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got := tt.export(exportGraph())
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatalf("failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read golden file: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("export differs from %s, run go test ./graph -update to accept it\ngot:\n%s\nwant:\n%s", path, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+// Package graph runs workflows as state graphs. Nodes update a typed state, edges pick the next
+// nodes, either always or depending on the state, and the nodes picked together run in parallel
+// before their states are merged. A checkpoint is taken after every step, so a run can be resumed,
+// and graphs export to Mermaid and DOT.
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+)
+
+// End is the target of edges that finish the run
+const End = "__end__"
+
+// defaultMaxSteps limits the steps of a run if not configured
+const defaultMaxSteps = 25
+
+// ErrStepLimit ends a run that used up its steps
+var ErrStepLimit = errors.New("step limit reached")
+
+// NodeFunc does the work of a node and returns the updated state
+type NodeFunc[S any] func(ctx context.Context, state S) (S, error)
+
+// Router picks a route of a conditional edge from the state
+type Router[S any] func(state S) string
+
+// conditional is a node's conditional edge, routes map the router's results to nodes
+type conditional[S any] struct {
+	router Router[S]
+	routes map[string]string
+}
+
+// Graph is a state graph over the state type S
+type Graph[S any] struct {
+	nodes map[string]NodeFunc[S]
+	// order is the order nodes were added in, for a stable export
+	order        []string
+	start        string
+	edges        map[string][]string
+	conditionals map[string]conditional[S]
+	// joins hold the nodes a join node waits for
+	joins map[string][]string
+
+	merge        func(state S, branches []S) (S, error)
+	clone        func(state S) S
+	maxSteps     int
+	checkpointer Checkpointer[S]
+
+	// errs are the mistakes made building the graph, reported by Validate
+	errs []error
+}
+
+// New creates an empty graph
+func New[S any]() *Graph[S] {
+	return &Graph[S]{
+		nodes:        make(map[string]NodeFunc[S]),
+		edges:        make(map[string][]string),
+		conditionals: make(map[string]conditional[S]),
+		joins:        make(map[string][]string),
+		maxSteps:     defaultMaxSteps,
+	}
+}
+
+// AddNode adds a node, the first one added is the start node unless SetStart says otherwise
+func (g *Graph[S]) AddNode(name string, fn NodeFunc[S]) {
+	switch {
+	case name == "" || name == End:
+		g.errs = append(g.errs, fmt.Errorf("invalid node name %q", name))
+		return
+	case g.nodes[name] != nil:
+		g.errs = append(g.errs, fmt.Errorf("node %s is added twice", name))
+		return
+	}
+
+	g.nodes[name] = fn
+	g.order = append(g.order, name)
+	if g.start == "" {
+		g.start = name
+	}
+}
+
+// SetStart sets the node a run starts with
+func (g *Graph[S]) SetStart(name string) {
+	g.start = name
+}
+
+// AddEdge always goes from one node to another, or to End
+func (g *Graph[S]) AddEdge(from, to string) {
+	g.edges[from] = append(g.edges[from], to)
+}
+
+// AddConditionalEdges goes from a node to the node of the route the router picks.
+// Without routes the router returns the node's name.
+func (g *Graph[S]) AddConditionalEdges(from string, router Router[S], routes map[string]string) {
+	if _, ok := g.conditionals[from]; ok {
+		g.errs = append(g.errs, fmt.Errorf("node %s has conditional edges twice", from))
+		return
+	}
+	g.conditionals[from] = conditional[S]{router: router, routes: routes}
+}
+
+// AddJoin adds edges from every node of from to the join node, which only runs once all of them finished
+func (g *Graph[S]) AddJoin(from []string, to string) {
+	for _, node := range from {
+		g.AddEdge(node, to)
+	}
+	g.joins[to] = append(g.joins[to], from...)
+}
+
+// SetMerge sets how the states of nodes that ran in parallel are combined into the next state.
+// Graphs with parallel branches need one.
+func (g *Graph[S]) SetMerge(merge func(state S, branches []S) (S, error)) {
+	g.merge = merge
+}
+
+// SetClone sets how the state is copied for each parallel branch, it's assigned by default
+func (g *Graph[S]) SetClone(clone func(state S) S) {
+	g.clone = clone
+}
+
+// SetMaxSteps limits the steps of a run, 0 means no limit
+func (g *Graph[S]) SetMaxSteps(steps int) {
+	g.maxSteps = steps
+}
+
+// SetCheckpointer saves a checkpoint after every step
+func (g *Graph[S]) SetCheckpointer(checkpointer Checkpointer[S]) {
+	g.checkpointer = checkpointer
+}
+
+// Validate reports every problem of the graph at once
+func (g *Graph[S]) Validate() error {
+	errs := slices.Clone(g.errs)
+
+	known := func(name string) bool {
+		return name == End || g.nodes[name] != nil
+	}
+
+	if g.nodes[g.start] == nil {
+		errs = append(errs, fmt.Errorf("start node %q is not defined", g.start))
+	}
+	for _, from := range sortedKeys(g.edges) {
+		if g.nodes[from] == nil {
+			errs = append(errs, fmt.Errorf("edge from unknown node %s", from))
+		}
+		for _, to := range g.edges[from] {
+			if !known(to) {
+				errs = append(errs, fmt.Errorf("edge %s -> %s goes to an unknown node", from, to))
+			}
+		}
+	}
+	for _, from := range sortedKeys(g.conditionals) {
+		if g.nodes[from] == nil {
+			errs = append(errs, fmt.Errorf("conditional edges from unknown node %s", from))
+		}
+		for _, route := range sortedKeys(g.conditionals[from].routes) {
+			if to := g.conditionals[from].routes[route]; !known(to) {
+				errs = append(errs, fmt.Errorf("route %s of %s goes to an unknown node %s", route, from, to))
+			}
+		}
+	}
+	for _, to := range sortedKeys(g.joins) {
+		if len(g.joins[to]) < 2 {
+			errs = append(errs, fmt.Errorf("join %s needs at least two nodes to wait for", to))
+		}
+	}
+	for _, name := range g.order {
+		// A conditional edge is taken along with the plain edges, so either makes the node branch out
+		branches := len(g.edges[name])
+		if _, routed := g.conditionals[name]; routed {
+			branches++
+		}
+		switch {
+		case branches == 0:
+			errs = append(errs, fmt.Errorf("node %s has no outgoing edge, add one to %s to finish there", name, End))
+		case branches > 1 && g.merge == nil:
+			errs = append(errs, fmt.Errorf("node %s branches out, parallel branches need a merge function", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run runs the graph from the start node until every branch reached End
+func (g *Graph[S]) Run(ctx context.Context, state S) (S, error) {
+	if err := g.Validate(); err != nil {
+		return state, fmt.Errorf("invalid graph: %w", err)
+	}
+
+	return g.run(ctx, Checkpoint[S]{State: state, Next: []string{g.start}})
+}
+
+// Resume continues a run from one of its checkpoints
+func (g *Graph[S]) Resume(ctx context.Context, checkpoint Checkpoint[S]) (S, error) {
+	if err := g.Validate(); err != nil {
+		return checkpoint.State, fmt.Errorf("invalid graph: %w", err)
+	}
+	for _, name := range checkpoint.Next {
+		if g.nodes[name] == nil {
+			return checkpoint.State, fmt.Errorf("checkpoint continues with unknown node %s", name)
+		}
+	}
+
+	return g.run(ctx, checkpoint)
+}
+
+// run takes steps from the checkpoint until no node is left to run
+func (g *Graph[S]) run(ctx context.Context, checkpoint Checkpoint[S]) (S, error) {
+	state := checkpoint.State
+	active := checkpoint.Next
+	step := checkpoint.Step
+
+	waiting := make(map[string][]string)
+	for join, arrived := range checkpoint.Waiting {
+		waiting[join] = slices.Clone(arrived)
+	}
+
+	for len(active) > 0 {
+		if g.maxSteps > 0 && step >= g.maxSteps {
+			return state, fmt.Errorf("%w: %d steps", ErrStepLimit, g.maxSteps)
+		}
+		step++
+
+		next, err := g.step(ctx, step, active, state)
+		if err != nil {
+			return state, err
+		}
+		state = next
+
+		finished := active
+		active, err = g.next(finished, state, waiting)
+		if err != nil {
+			return state, err
+		}
+
+		if g.checkpointer != nil {
+			checkpoint := Checkpoint[S]{
+				Step:    step,
+				Time:    time.Now(),
+				Nodes:   finished,
+				State:   state,
+				Next:    active,
+				Waiting: make(map[string][]string, len(waiting)),
+			}
+			for join, arrived := range waiting {
+				checkpoint.Waiting[join] = slices.Clone(arrived)
+			}
+			if err := g.checkpointer.Save(ctx, checkpoint); err != nil {
+				return state, fmt.Errorf("failed to save checkpoint: %w", err)
+			}
+		}
+	}
+
+	return state, nil
+}
+
+// step runs the active nodes, in parallel if there are several, and returns the merged state
+func (g *Graph[S]) step(ctx context.Context, step int, active []string, state S) (S, error) {
+	if len(active) == 1 {
+		return g.runNode(ctx, step, active[0], state)
+	}
+	if g.merge == nil {
+		return state, fmt.Errorf("nodes %v ran in parallel without a merge function", active)
+	}
+
+	branches := make([]S, len(active))
+	errs := make([]error, len(active))
+	var wg sync.WaitGroup
+	for i, name := range active {
+		branch := state
+		if g.clone != nil {
+			branch = g.clone(state)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			branches[i], errs[i] = g.runNode(ctx, step, name, branch)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return state, err
+	}
+
+	merged, err := g.merge(state, branches)
+	if err != nil {
+		return state, fmt.Errorf("failed to merge %v: %w", active, err)
+	}
+	return merged, nil
+}
+
+// runNode runs a node, traced as a node span
+func (g *Graph[S]) runNode(ctx context.Context, step int, name string, state S) (result S, err error) {
+	ctx, span := internal.StartSpan(ctx, internal.SpanNode, name)
+	span.SetAttribute("step", step)
+	defer func() {
+		span.Finish(err)
+	}()
+
+	result, err = g.nodes[name](ctx, state)
+	if err != nil {
+		return state, fmt.Errorf("node %s failed: %w", name, err)
+	}
+	return result, nil
+}
+
+// next returns the nodes the edges of the finished nodes lead to. Joins wait in waiting until
+// all their nodes finished.
+func (g *Graph[S]) next(finished []string, state S, waiting map[string][]string) ([]string, error) {
+	var next []string
+	add := func(name string) {
+		if name != End && !slices.Contains(next, name) {
+			next = append(next, name)
+		}
+	}
+
+	for _, name := range finished {
+		targets := slices.Clone(g.edges[name])
+		if conditional, ok := g.conditionals[name]; ok {
+			route := conditional.router(state)
+			to := route
+			if conditional.routes != nil {
+				var ok bool
+				if to, ok = conditional.routes[route]; !ok {
+					return nil, fmt.Errorf("node %s picked unknown route %q", name, route)
+				}
+			}
+			if to != End && g.nodes[to] == nil {
+				return nil, fmt.Errorf("node %s routed to unknown node %q", name, to)
+			}
+			targets = append(targets, to)
+		}
+
+		for _, to := range targets {
+			if !slices.Contains(g.joins[to], name) {
+				add(to)
+				continue
+			}
+
+			if !slices.Contains(waiting[to], name) {
+				waiting[to] = append(waiting[to], name)
+			}
+			if len(waiting[to]) == len(g.joins[to]) {
+				delete(waiting, to)
+				add(to)
+			}
+		}
+	}
+
+	return next, nil
+}
+
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
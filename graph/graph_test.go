@@ -0,0 +1,507 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// trail is the state of the test graphs, the names of the nodes in the order they ran
+type trail []string
+
+// visit is a node that adds its name to the trail
+func visit(name string) NodeFunc[trail] {
+	return func(ctx context.Context, state trail) (trail, error) {
+		return append(slices.Clone(state), name), nil
+	}
+}
+
+// mergeTrails adds the nodes each branch visited to the trail, in the order of the branches
+func mergeTrails(state trail, branches []trail) (trail, error) {
+	merged := slices.Clone(state)
+	for _, branch := range branches {
+		merged = append(merged, branch[len(state):]...)
+	}
+	return merged, nil
+}
+
+// routeTo is a router that always picks the route
+func routeTo(route string) Router[trail] {
+	return func(state trail) string { return route }
+}
+
+// joinGraph fans out from start to a and b, b takes another step through c, and the join
+// waits for a and c
+func joinGraph() *Graph[trail] {
+	g := New[trail]()
+	for _, name := range []string{"start", "a", "b", "c", "join"} {
+		g.AddNode(name, visit(name))
+	}
+	g.AddEdge("start", "a")
+	g.AddEdge("start", "b")
+	g.AddEdge("b", "c")
+	g.AddJoin([]string{"a", "c"}, "join")
+	g.AddEdge("join", End)
+	g.SetMerge(mergeTrails)
+	return g
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(g *Graph[trail])
+		// errs are parts of the expected errors, none if the graph is valid
+		errs []string
+	}{
+		{
+			name: "linear",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddEdge("a", "b")
+				g.AddEdge("b", End)
+			},
+		},
+		{
+			name: "routed loop",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddConditionalEdges("a", routeTo("again"), map[string]string{"again": "a", "done": End})
+			},
+		},
+		{
+			name:  "empty",
+			build: func(g *Graph[trail]) {},
+			errs:  []string{`start node "" is not defined`},
+		},
+		{
+			name: "unknown start",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddEdge("a", End)
+				g.SetStart("missing")
+			},
+			errs: []string{`start node "missing" is not defined`},
+		},
+		{
+			name: "invalid and duplicate nodes",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddNode("a", visit("a"))
+				g.AddNode(End, visit(End))
+				g.AddEdge("a", End)
+			},
+			errs: []string{"node a is added twice", `invalid node name "__end__"`},
+		},
+		{
+			name: "unknown edge nodes",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddEdge("a", "missing")
+				g.AddEdge("ghost", End)
+			},
+			errs: []string{"edge a -> missing goes to an unknown node", "edge from unknown node ghost"},
+		},
+		{
+			name: "unknown route",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddConditionalEdges("a", routeTo("next"), map[string]string{"next": "missing"})
+				g.AddConditionalEdges("ghost", routeTo("next"), nil)
+			},
+			errs: []string{"route next of a goes to an unknown node missing", "conditional edges from unknown node ghost"},
+		},
+		{
+			name: "conditional edges twice",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddConditionalEdges("a", routeTo(End), nil)
+				g.AddConditionalEdges("a", routeTo(End), nil)
+			},
+			errs: []string{"node a has conditional edges twice"},
+		},
+		{
+			name: "no outgoing edge",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddEdge("a", "b")
+			},
+			errs: []string{"node b has no outgoing edge"},
+		},
+		{
+			name: "branches without merge",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddNode("c", visit("c"))
+				g.AddEdge("a", "b")
+				g.AddEdge("a", "c")
+				g.AddEdge("b", End)
+				g.AddEdge("c", End)
+			},
+			errs: []string{"node a branches out"},
+		},
+		{
+			name: "edge and conditional edges without merge",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddNode("c", visit("c"))
+				g.AddEdge("a", "b")
+				g.AddConditionalEdges("a", routeTo("c"), map[string]string{"c": "c"})
+				g.AddEdge("b", End)
+				g.AddEdge("c", End)
+			},
+			errs: []string{"node a branches out"},
+		},
+		{
+			name: "edge and conditional edges with merge",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddNode("c", visit("c"))
+				g.AddEdge("a", "b")
+				g.AddConditionalEdges("a", routeTo("c"), map[string]string{"c": "c"})
+				g.AddEdge("b", End)
+				g.AddEdge("c", End)
+				g.SetMerge(mergeTrails)
+			},
+		},
+		{
+			name: "join of one node",
+			build: func(g *Graph[trail]) {
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddJoin([]string{"a"}, "b")
+				g.AddEdge("b", End)
+			},
+			errs: []string{"join b needs at least two nodes to wait for"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New[trail]()
+			tt.build(g)
+
+			err := g.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors %q", tt.errs)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, want an error containing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	errNode := errors.New("node broke")
+
+	tests := []struct {
+		name  string
+		build func() *Graph[trail]
+		want  trail
+		// err is part of the expected error, is is the error it wraps
+		err string
+		is  error
+	}{
+		{
+			name: "linear",
+			build: func() *Graph[trail] {
+				g := New[trail]()
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddEdge("a", "b")
+				g.AddEdge("b", End)
+				return g
+			},
+			want: trail{"a", "b"},
+		},
+		{
+			name: "conditional routes",
+			build: func() *Graph[trail] {
+				g := New[trail]()
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddNode("c", visit("c"))
+				g.AddConditionalEdges("a", routeTo("second"), map[string]string{"first": "b", "second": "c"})
+				g.AddEdge("b", End)
+				g.AddEdge("c", End)
+				return g
+			},
+			want: trail{"a", "c"},
+		},
+		{
+			name: "router picks the node",
+			build: func() *Graph[trail] {
+				g := New[trail]()
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddConditionalEdges("a", func(state trail) string {
+					if len(state) < 3 {
+						return "a"
+					}
+					return "b"
+				}, nil)
+				g.AddEdge("b", End)
+				return g
+			},
+			want: trail{"a", "a", "a", "b"},
+		},
+		{
+			name: "parallel branches merge",
+			build: func() *Graph[trail] {
+				g := New[trail]()
+				g.AddNode("start", visit("start"))
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddEdge("start", "a")
+				g.AddEdge("start", "b")
+				g.AddEdge("a", End)
+				g.AddEdge("b", End)
+				g.SetMerge(mergeTrails)
+				return g
+			},
+			want: trail{"start", "a", "b"},
+		},
+		{
+			name:  "join waits across steps",
+			build: joinGraph,
+			want:  trail{"start", "a", "b", "c", "join"},
+		},
+		{
+			name: "edge and conditional edge branch out",
+			build: func() *Graph[trail] {
+				g := New[trail]()
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddNode("c", visit("c"))
+				g.AddEdge("a", "b")
+				g.AddConditionalEdges("a", routeTo("c"), map[string]string{"c": "c"})
+				g.AddEdge("b", End)
+				g.AddEdge("c", End)
+				g.SetMerge(mergeTrails)
+				return g
+			},
+			want: trail{"a", "b", "c"},
+		},
+		{
+			name: "step limit",
+			build: func() *Graph[trail] {
+				g := New[trail]()
+				g.AddNode("a", visit("a"))
+				g.AddConditionalEdges("a", routeTo("a"), nil)
+				g.SetMaxSteps(3)
+				return g
+			},
+			want: trail{"a", "a", "a"},
+			is:   ErrStepLimit,
+			err:  "step limit reached: 3 steps",
+		},
+		{
+			name: "merge error",
+			build: func() *Graph[trail] {
+				g := New[trail]()
+				g.AddNode("start", visit("start"))
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", visit("b"))
+				g.AddEdge("start", "a")
+				g.AddEdge("start", "b")
+				g.AddEdge("a", End)
+				g.AddEdge("b", End)
+				g.SetMerge(func(state trail, branches []trail) (trail, error) {
+					return state, errors.New("branches disagree")
+				})
+				return g
+			},
+			want: trail{"start"},
+			err:  "failed to merge [a b]: branches disagree",
+		},
+		{
+			name: "node error",
+			build: func() *Graph[trail] {
+				g := New[trail]()
+				g.AddNode("a", visit("a"))
+				g.AddNode("b", func(ctx context.Context, state trail) (trail, error) {
+					return state, errNode
+				})
+				g.AddEdge("a", "b")
+				g.AddEdge("b", End)
+				return g
+			},
+			want: trail{"a"},
+			is:   errNode,
+			err:  "node b failed",
+		},
+		{
+			name: "unknown route picked",
+			build: func() *Graph[trail] {
+				g := New[trail]()
+				g.AddNode("a", visit("a"))
+				g.AddConditionalEdges("a", routeTo("other"), map[string]string{"done": End})
+				return g
+			},
+			want: trail{"a"},
+			err:  `node a picked unknown route "other"`,
+		},
+		{
+			name: "invalid graph",
+			build: func() *Graph[trail] {
+				g := New[trail]()
+				g.AddNode("a", visit("a"))
+				return g
+			},
+			err: "invalid graph",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.build().Run(context.Background(), nil)
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("Run() error = %v, want none", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("Run() error = %v, want one containing %q", err, tt.err)
+			case tt.is != nil && !errors.Is(err, tt.is):
+				t.Fatalf("Run() error = %v, want it to wrap %v", err, tt.is)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Run() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	g := joinGraph()
+	checkpointer := &MemoryCheckpointer[trail]{}
+	g.SetCheckpointer(checkpointer)
+
+	if _, err := g.Run(context.Background(), nil); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []struct {
+		nodes, next []string
+		waiting     map[string][]string
+	}{
+		{nodes: []string{"start"}, next: []string{"a", "b"}},
+		{nodes: []string{"a", "b"}, next: []string{"c"}, waiting: map[string][]string{"join": {"a"}}},
+		{nodes: []string{"c"}, next: []string{"join"}},
+		{nodes: []string{"join"}},
+	}
+	checkpoints := checkpointer.Checkpoints()
+	if len(checkpoints) != len(want) {
+		t.Fatalf("got %d checkpoints, want %d", len(checkpoints), len(want))
+	}
+	for i, checkpoint := range checkpoints {
+		if checkpoint.Step != i+1 {
+			t.Errorf("checkpoint %d has step %d", i, checkpoint.Step)
+		}
+		if !slices.Equal(checkpoint.Nodes, want[i].nodes) || !slices.Equal(checkpoint.Next, want[i].next) {
+			t.Errorf("checkpoint %d ran %q and continues with %q, want %q and %q", i, checkpoint.Nodes, checkpoint.Next, want[i].nodes, want[i].next)
+		}
+		if len(checkpoint.Waiting) != len(want[i].waiting) {
+			t.Errorf("checkpoint %d has waiting %v, want %v", i, checkpoint.Waiting, want[i].waiting)
+		}
+		for join, arrived := range want[i].waiting {
+			if !slices.Equal(checkpoint.Waiting[join], arrived) {
+				t.Errorf("checkpoint %d has waiting %v, want %v", i, checkpoint.Waiting, want[i].waiting)
+			}
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name       string
+		checkpoint Checkpoint[trail]
+		want       trail
+		steps      int
+		err        string
+	}{
+		{
+			name: "join keeps waiting",
+			checkpoint: Checkpoint[trail]{
+				Step:    2,
+				State:   trail{"start", "a", "b"},
+				Next:    []string{"c"},
+				Waiting: map[string][]string{"join": {"a"}},
+			},
+			want:  trail{"start", "a", "b", "c", "join"},
+			steps: 4,
+		},
+		{
+			name: "join without the nodes it got",
+			checkpoint: Checkpoint[trail]{
+				Step:  2,
+				State: trail{"start", "a", "b"},
+				Next:  []string{"c"},
+			},
+			want:  trail{"start", "a", "b", "c"},
+			steps: 3,
+		},
+		{
+			name: "finished run",
+			checkpoint: Checkpoint[trail]{
+				Step:  4,
+				State: trail{"start", "a", "b", "c", "join"},
+			},
+			want: trail{"start", "a", "b", "c", "join"},
+		},
+		{
+			name: "unknown node",
+			checkpoint: Checkpoint[trail]{
+				Step:  1,
+				State: trail{"start"},
+				Next:  []string{"removed"},
+			},
+			want: trail{"start"},
+			err:  "checkpoint continues with unknown node removed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := joinGraph()
+			checkpointer := &MemoryCheckpointer[trail]{}
+			g.SetCheckpointer(checkpointer)
+
+			got, err := g.Resume(context.Background(), tt.checkpoint)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("Resume() error = %v, want none", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("Resume() error = %v, want one containing %q", err, tt.err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Resume() = %q, want %q", got, tt.want)
+			}
+
+			last, ok := checkpointer.Last()
+			if tt.steps == 0 {
+				if ok {
+					t.Errorf("Resume() saved checkpoint of step %d, want none", last.Step)
+				}
+				return
+			}
+			if !ok || last.Step != tt.steps {
+				t.Errorf("Resume() ended at step %d, want %d", last.Step, tt.steps)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	"github.com/RB387/wolt-ai-agents-talk/orchestrator"
+)
+
+// LLMNode calls the model with the request made from the state and applies the reply to the state
+func LLMNode[S any](model internal.ChatModel, request func(state S) internal.ChatRequest, apply func(state S, reply internal.Message) (S, error)) NodeFunc[S] {
+	return func(ctx context.Context, state S) (S, error) {
+		reply, err := model.Chat(ctx, request(state))
+		if err != nil {
+			return state, err
+		}
+		return apply(state, reply)
+	}
+}
+
+// ToolNode calls a tool with the arguments taken from the state and applies its observation.
+// Recoverable tool errors are applied as the observation, fatal ones fail the node.
+func ToolNode[S any](tracker *internal.UsageTracker, name string, run func(ctx context.Context, args map[string]any) (string, error), args func(state S) map[string]any, apply func(state S, observation string) (S, error)) NodeFunc[S] {
+	return func(ctx context.Context, state S) (S, error) {
+		input := args(state)
+
+		ctx, span := internal.StartSpan(ctx, internal.SpanTool, name)
+		data, _ := json.Marshal(input)
+		span.Input = string(data)
+
+		observation, err := run(ctx, input)
+		tracker.RecordTool("graph", name, time.Since(span.Start))
+		if err != nil {
+			toolErr := internal.NewToolError(name, err)
+			if toolErr.Fatal {
+				span.Finish(toolErr)
+				return state, toolErr
+			}
+			observation = toolErr.Observation()
+			err = toolErr
+		}
+		span.Output = observation
+		span.Finish(err)
+
+		return apply(state, observation)
+	}
+}
+
+// AgentNode hands a task made from the state to an agent, team or pipeline of the orchestrator
+// and applies its output
+func AgentNode[S any](engine *orchestrator.Engine, node orchestrator.Node, task func(state S) string, apply func(state S, output string) (S, error)) NodeFunc[S] {
+	return func(ctx context.Context, state S) (S, error) {
+		result, err := engine.Run(ctx, node, task(state), nil)
+		if err != nil {
+			return state, err
+		}
+		return apply(state, result.Output)
+	}
+}
+
+// SubgraphNode runs another graph over the same state
+func SubgraphNode[S any](graph *Graph[S]) NodeFunc[S] {
+	return graph.Run
+}
@@ -0,0 +1,299 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// BatchQuery is a single query of a batch
+type BatchQuery struct {
+	ID    string `json:"id"`
+	Query string `json:"query"`
+}
+
+// Answer is what an agent variant returns for a single query
+type Answer struct {
+	Text  string
+	Steps int
+	Usage UsageSummary
+}
+
+// Answerer answers a single query. It must be safe to call concurrently.
+type Answerer func(ctx context.Context, query string) (Answer, error)
+
+// BatchResult is a line of the batch output
+type BatchResult struct {
+	ID        string  `json:"id"`
+	Query     string  `json:"query"`
+	Answer    string  `json:"answer"`
+	Steps     int     `json:"steps"`
+	Usage     Usage   `json:"usage"`
+	Cost      float64 `json:"cost_usd"`
+	LatencyMs int64   `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// LoadBatchQueries reads queries from a .jsonl file ({"id": ..., "query": ...} per line)
+// or a .csv file with a header containing a "query" and optionally an "id" column.
+// Queries without an id get one made from their text.
+func LoadBatchQueries(path string) ([]BatchQuery, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open batch input: %w", err)
+	}
+	defer file.Close()
+
+	var queries []BatchQuery
+	if filepath.Ext(path) == ".csv" {
+		queries, err = readCSVQueries(file)
+	} else {
+		queries, err = readJSONLQueries(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Ids made from the query text stay the same when the file is edited, repeated queries are numbered
+	seen := make(map[string]int)
+	for i := range queries {
+		if queries[i].ID != "" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(queries[i].Query))
+		id := hex.EncodeToString(sum[:6])
+		if seen[id]++; seen[id] > 1 {
+			id += "-" + strconv.Itoa(seen[id])
+		}
+		queries[i].ID = id
+	}
+
+	return queries, nil
+}
+
+// OpenLines opens a file of JSON lines for appending. A last line cut off by an interruption
+// is ended first, so the next line isn't appended to it.
+func OpenLines(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return file, err
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if last[0] != '\n' {
+		if _, err := file.Write([]byte{'\n'}); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+func readJSONLQueries(r io.Reader) ([]BatchQuery, error) {
+	var queries []BatchQuery
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var query BatchQuery
+		if err := json.Unmarshal(scanner.Bytes(), &query); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %w", line, err)
+		}
+		queries = append(queries, query)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch input: %w", err)
+	}
+
+	return queries, nil
+}
+
+func readCSVQueries(r io.Reader) ([]BatchQuery, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	idColumn, queryColumn := -1, -1
+	for i, name := range records[0] {
+		switch name {
+		case "id":
+			idColumn = i
+		case "query":
+			queryColumn = i
+		}
+	}
+	if queryColumn < 0 {
+		return nil, fmt.Errorf("csv header has no query column")
+	}
+
+	var queries []BatchQuery
+	for _, record := range records[1:] {
+		query := BatchQuery{Query: record[queryColumn]}
+		if idColumn >= 0 {
+			query.ID = record[idColumn]
+		}
+		queries = append(queries, query)
+	}
+
+	return queries, nil
+}
+
+// completedQueries returns the ids that already have a successful result in the output file
+func completedQueries(path string) (map[string]bool, error) {
+	completed := make(map[string]bool)
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return completed, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open batch output: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var result BatchResult
+		// A line cut off by an interruption is simply run again
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue
+		}
+		completed[result.ID] = result.Error == ""
+	}
+
+	return completed, scanner.Err()
+}
+
+// RunBatch answers the queries with up to concurrency parallel runs, appending results to outPath.
+// Queries that already have a successful result in outPath are skipped, so an interrupted batch
+// can be resumed by running it again; failed queries are retried. Ctrl-C stops the batch, the
+// queries interrupted by it aren't written.
+func RunBatch(ctx context.Context, queries []BatchQuery, outPath string, concurrency int, answerer Answerer) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	completed, err := completedQueries(outPath)
+	if err != nil {
+		return err
+	}
+
+	out, err := OpenLines(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to open batch output: %w", err)
+	}
+	defer out.Close()
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		done     int
+		failed   int
+		writeErr error
+	)
+	slots := make(chan struct{}, concurrency)
+
+	var pending []BatchQuery
+	for _, query := range queries {
+		if !completed[query.ID] {
+			pending = append(pending, query)
+		}
+	}
+	Logger("batch").Info("starting batch", "queries", len(queries), "done", len(queries)-len(pending), "pending", len(pending))
+
+	for _, query := range pending {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(query BatchQuery) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			start := time.Now()
+			result := BatchResult{ID: query.ID, Query: query.Query}
+
+			answer, err := answerer(ctx, query.Query)
+			result.LatencyMs = time.Since(start).Milliseconds()
+			result.Answer = answer.Text
+			result.Steps = answer.Steps
+			result.Usage = answer.Usage.Usage
+			result.Cost = answer.Usage.Cost
+			if err != nil {
+				if ctx.Err() != nil {
+					Logger("batch").Info("query interrupted", "id", query.ID)
+					return
+				}
+				result.Error = err.Error()
+			}
+
+			// A single write per line, so an interruption can cut off at most the last line
+			data, err := json.Marshal(result)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err == nil {
+				_, err = out.Write(append(data, '\n'))
+			}
+			if err != nil && writeErr == nil {
+				writeErr = fmt.Errorf("failed to write result %s: %w", query.ID, err)
+			}
+
+			done++
+			if result.Error != "" {
+				failed++
+			}
+			Logger("batch").Info("query done", "id", query.ID, "done", done, "pending", len(pending)-done, "failed", failed, "latency", time.Since(start).Round(time.Millisecond))
+		}(query)
+	}
+
+	wg.Wait()
+	if writeErr != nil {
+		return writeErr
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("batch interrupted, run it again to resume: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/openai/openai-go"
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Tokenizer counts tokens in a text
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// tiktokenTokenizer counts tokens with an OpenAI BPE encoding
+type tiktokenTokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+func (t tiktokenTokenizer) Count(text string) int {
+	return len(t.encoding.EncodeOrdinary(text))
+}
+
+// approxTokenizer estimates roughly four characters per token
+type approxTokenizer struct{}
+
+func (approxTokenizer) Count(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// defaultEncoding is used for models tiktoken doesn't know, e.g. gpt-4.1 and the o-series
+const defaultEncoding = "o200k_base"
+
+// NewTokenizer returns a tokenizer with the model's encoding, or o200k_base for newer models,
+// falling back to an estimate if the encoding can't be loaded (e.g. when offline)
+func NewTokenizer(model string) Tokenizer {
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		encoding, err = tiktoken.GetEncoding(defaultEncoding)
+	}
+	if err != nil {
+		Logger("context").Warn("failed to load tokenizer, falling back to estimates", "model", model, "error", err)
+		return approxTokenizer{}
+	}
+
+	return tiktokenTokenizer{encoding: encoding}
+}
+
+// Summarizer condenses text that doesn't fit into the context window
+type Summarizer interface {
+	Summarize(ctx context.Context, text string, maxTokens int) (string, error)
+}
+
+// OpenAISummarizer summarizes text with a chat model
+type OpenAISummarizer struct {
+	client  openai.Client
+	model   string
+	tracker *UsageTracker
+}
+
+// NewOpenAISummarizer creates a summarizer backed by the given model, recording its usage in tracker
+func NewOpenAISummarizer(client openai.Client, model string, tracker *UsageTracker) *OpenAISummarizer {
+	return &OpenAISummarizer{
+		client:  client,
+		model:   model,
+		tracker: tracker,
+	}
+}
+
+// Summarize asks the model for a summary no longer than maxTokens
+func (s *OpenAISummarizer) Summarize(ctx context.Context, text string, maxTokens int) (summary string, err error) {
+	_, span := StartSpan(ctx, SpanModel, s.model)
+	span.Input = text
+	span.SetAttribute("agent", "summarizer")
+	defer func() {
+		span.Output = summary
+		span.Finish(err)
+	}()
+
+	chatCompletion, err := s.client.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage("Summarize the text for an agent that will use it to answer a question. Keep facts, numbers, dates, names and URLs. Be concise."),
+				openai.UserMessage(text),
+			},
+			Model:               s.model,
+			MaxCompletionTokens: openai.Int(int64(maxTokens)),
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize: %w", err)
+	}
+	s.tracker.RecordCompletion("summarizer", 0, *chatCompletion)
+
+	// The summary is capped at maxTokens, so a cut off one is still used
+	content, err := CompletionContent(*chatCompletion)
+	if err != nil && !errors.Is(err, ErrTruncated) {
+		return "", &ModelError{Model: s.model, Err: err}
+	}
+
+	return content, nil
+}
+
+// Message is a single conversation message tracked by the ContextManager
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Name is the agent that wrote an assistant message
+	Name string `json:"name,omitempty"`
+	// ToolCalls are the functions an assistant message calls
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the call a tool message answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Pinned messages (system prompt, original question) are never dropped
+	Pinned bool `json:"-"`
+}
+
+// ContextOptions configures the ContextManager
+type ContextOptions struct {
+	// Budget is the maximum number of tokens the conversation may use
+	Budget int
+	// MaxObservationTokens is the maximum size of a single observation
+	MaxObservationTokens int
+	// Summarizer is optional; without it oversized content is truncated and old turns dropped
+	Summarizer Summarizer
+}
+
+// ContextManager keeps a conversation within the model's context window
+type ContextManager struct {
+	tokenizer Tokenizer
+	options   ContextOptions
+}
+
+// NewContextManager creates a context manager
+func NewContextManager(tokenizer Tokenizer, options ContextOptions) *ContextManager {
+	return &ContextManager{
+		tokenizer: tokenizer,
+		options:   options,
+	}
+}
+
+// Count returns the number of tokens used by the messages
+func (m *ContextManager) Count(messages []Message) int {
+	var total int
+	for _, message := range messages {
+		// Every message carries a few tokens of overhead for its role and separators
+		total += m.tokenizer.Count(message.Content) + 4
+	}
+	return total
+}
+
+// FitObservation summarizes or truncates an observation that exceeds MaxObservationTokens
+func (m *ContextManager) FitObservation(ctx context.Context, observation string) string {
+	tokens := m.tokenizer.Count(observation)
+	if tokens <= m.options.MaxObservationTokens {
+		return observation
+	}
+
+	if m.options.Summarizer != nil {
+		summary, err := m.options.Summarizer.Summarize(ctx, observation, m.options.MaxObservationTokens)
+		if err == nil {
+			return fmt.Sprintf("[summary of %d tokens]\n%s", tokens, summary)
+		}
+		Logger("context").Warn("failed to summarize observation, truncating instead", "error", err)
+	}
+
+	return m.truncate(observation, tokens, m.options.MaxObservationTokens)
+}
+
+// truncate cuts text down to roughly maxTokens, keeping the beginning
+func (m *ContextManager) truncate(text string, tokens, maxTokens int) string {
+	// Scale by characters per token of this text so no second tokenizer pass is needed
+	cut := len(text) * maxTokens / tokens
+	for cut > 0 && cut < len(text) && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+
+	return fmt.Sprintf("%s\n[truncated %d of %d tokens]", text[:cut], tokens-maxTokens, tokens)
+}
+
+// Compact drops the oldest unpinned messages until the conversation fits the budget, keeping
+// the order of the rest. With a summarizer the dropped messages are replaced by a single summary
+// message where the first of them was.
+func (m *ContextManager) Compact(ctx context.Context, messages []Message) []Message {
+	total := m.Count(messages)
+	if total <= m.options.Budget {
+		return messages
+	}
+
+	var unpinned []int
+	for i, message := range messages {
+		if !message.Pinned {
+			unpinned = append(unpinned, i)
+		}
+	}
+
+	// Always keep the latest turn, it's what the model has to react to
+	dropped := make(map[int]bool)
+	var droppedMessages []Message
+	for _, i := range unpinned[:max(len(unpinned)-1, 0)] {
+		if total <= m.options.Budget {
+			break
+		}
+		dropped[i] = true
+		droppedMessages = append(droppedMessages, messages[i])
+		total -= m.Count(messages[i : i+1])
+	}
+
+	if len(dropped) == 0 {
+		return messages
+	}
+
+	Logger("context").Info("compacting context", "dropped_messages", len(dropped))
+
+	var summary *Message
+	if m.options.Summarizer != nil {
+		var transcript strings.Builder
+		for _, message := range droppedMessages {
+			transcript.WriteString(fmt.Sprintf("%s: %s\n", message.Role, message.Content))
+		}
+
+		text, err := m.options.Summarizer.Summarize(ctx, transcript.String(), m.options.MaxObservationTokens)
+		if err == nil {
+			summary = &Message{Role: "user", Content: "Summary of earlier steps: " + text}
+		} else {
+			Logger("context").Warn("failed to summarize old messages, dropping them", "error", err)
+		}
+	}
+
+	compacted := make([]Message, 0, len(messages)-len(dropped)+1)
+	for i, message := range messages {
+		if !dropped[i] {
+			compacted = append(compacted, message)
+		} else if summary != nil {
+			compacted = append(compacted, *summary)
+			summary = nil
+		}
+	}
+	return compacted
+}
+
+// ToOpenAI converts messages into openai-go message params
+func ToOpenAI(messages []Message) []openai.ChatCompletionMessageParamUnion {
+	params := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages))
+	for _, message := range messages {
+		switch message.Role {
+		case "system":
+			params = append(params, openai.SystemMessage(message.Content))
+		case "assistant":
+			assistant := openai.AssistantMessage(message.Content)
+			for _, call := range message.ToolCalls {
+				assistant.OfAssistant.ToolCalls = append(assistant.OfAssistant.ToolCalls, openai.ChatCompletionMessageToolCallParam{
+					ID: call.ID,
+					Function: openai.ChatCompletionMessageToolCallFunctionParam{
+						Name:      call.Name,
+						Arguments: call.Arguments,
+					},
+				})
+			}
+			params = append(params, assistant)
+		case "tool":
+			params = append(params, openai.ToolMessage(message.Content, message.ToolCallID))
+		default:
+			params = append(params, openai.UserMessage(message.Content))
+		}
+	}
+	return params
+}
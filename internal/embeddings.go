@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+
+	"github.com/openai/openai-go"
+)
+
+// Embedder turns texts into vectors
+type Embedder interface {
+	// Name identifies the embedder, vectors of different embedders can't be compared
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// OpenAIEmbedder embeds texts with the OpenAI embeddings API
+type OpenAIEmbedder struct {
+	client  openai.Client
+	model   openai.EmbeddingModel
+	tracker *UsageTracker
+}
+
+// NewOpenAIEmbedder creates an embedder backed by the given model, recording its usage in tracker
+func NewOpenAIEmbedder(client openai.Client, model openai.EmbeddingModel, tracker *UsageTracker) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		client:  client,
+		model:   model,
+		tracker: tracker,
+	}
+}
+
+func (e *OpenAIEmbedder) Name() string {
+	return "openai:" + string(e.model)
+}
+
+// Embed sends all texts in a single request
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	resp, err := e.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+		Model: e.model,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embeddings: %w", err)
+	}
+	e.tracker.Record("embedder", 0, resp.Model, Usage{PromptTokens: resp.Usage.PromptTokens})
+
+	vectors := make([][]float64, len(texts))
+	for _, embedding := range resp.Data {
+		vectors[embedding.Index] = embedding.Embedding
+	}
+
+	return vectors, nil
+}
+
+// HashingEmbedder embeds texts locally by hashing their words into a fixed number of buckets.
+// It only captures keyword overlap, but works offline and costs nothing.
+type HashingEmbedder struct {
+	dimensions int
+}
+
+// NewHashingEmbedder creates a local embedder producing vectors of the given size
+func NewHashingEmbedder(dimensions int) *HashingEmbedder {
+	return &HashingEmbedder{dimensions: dimensions}
+}
+
+func (e *HashingEmbedder) Name() string {
+	return fmt.Sprintf("hashing:%d", e.dimensions)
+}
+
+// Embed hashes the words of every text, weighting them by log term frequency
+func (e *HashingEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+
+	for i, text := range texts {
+		counts := make(map[uint32]float64)
+		for _, word := range tokenize(text) {
+			hash := fnv.New32a()
+			hash.Write([]byte(word))
+			counts[hash.Sum32()%uint32(e.dimensions)]++
+		}
+
+		vector := make([]float64, e.dimensions)
+		for bucket, count := range counts {
+			vector[bucket] = 1 + math.Log(count)
+		}
+		vectors[i] = normalize(vector)
+	}
+
+	return vectors, nil
+}
+
+// NewEmbedderFromEnv returns the OpenAI embedder if EMBEDDER=openai, the free local one otherwise
+func NewEmbedderFromEnv(tracker *UsageTracker) Embedder {
+	if os.Getenv("EMBEDDER") == "openai" {
+		return NewOpenAIEmbedder(NewOpenAIClient(), openai.EmbeddingModelTextEmbedding3Small, tracker)
+	}
+
+	return NewHashingEmbedder(512)
+}
+
+// normalize scales the vector to unit length
+func normalize(vector []float64) []float64 {
+	var norm float64
+	for _, value := range vector {
+		norm += value * value
+	}
+	if norm == 0 {
+		return vector
+	}
+
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
+
+// cosine returns the cosine similarity of two vectors
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/openai/openai-go"
+)
+
+// Model call errors, wrapped in a ModelError
+var (
+	ErrNoChoices     = errors.New("model returned no choices")
+	ErrContentFilter = errors.New("response was blocked by the content filter")
+	// ErrTruncated is returned together with the partial content, which may still be usable
+	ErrTruncated = errors.New("response was cut off at the token limit")
+)
+
+// ErrMaxIterations is returned with the last response of a run that gave no final answer
+// within its iteration limit
+var ErrMaxIterations = errors.New("no final answer within the iteration limit")
+
+// ModelError is a failed model call
+type ModelError struct {
+	Model string
+	Step  int
+	Err   error
+}
+
+func (e *ModelError) Error() string {
+	if e.Step == 0 {
+		return fmt.Sprintf("model %s failed: %v", e.Model, e.Err)
+	}
+	return fmt.Sprintf("model %s failed at step %d: %v", e.Model, e.Step, e.Err)
+}
+
+func (e *ModelError) Unwrap() error {
+	return e.Err
+}
+
+// CompletionContent returns the content of the first choice, or an error if there's none,
+// it was filtered or it was cut off. Cut off content is returned along with ErrTruncated.
+func CompletionContent(completion openai.ChatCompletion) (string, error) {
+	if len(completion.Choices) == 0 {
+		return "", ErrNoChoices
+	}
+
+	choice := completion.Choices[0]
+	switch choice.FinishReason {
+	case "content_filter":
+		return "", ErrContentFilter
+	case "length":
+		return choice.Message.Content, ErrTruncated
+	}
+
+	return choice.Message.Content, nil
+}
+
+// StatusError is an unexpected HTTP status returned by an external API
+type StatusError struct {
+	Service    string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned unexpected status code: %d", e.Service, e.StatusCode)
+}
+
+// ToolError is a failed tool call. Recoverable errors are fed back to the model as the
+// observation so it can try something else, fatal ones abort the run.
+type ToolError struct {
+	Tool  string
+	Fatal bool
+	Err   error
+}
+
+func (e *ToolError) Error() string {
+	return fmt.Sprintf("tool %s failed: %v", e.Tool, e.Err)
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+// Observation is what the model is told about a recoverable error
+func (e *ToolError) Observation() string {
+	return fmt.Sprintf("Error: %v", e.Err)
+}
+
+// NewToolError classifies err: a cancelled run or a rejected API key is fatal,
+// anything else (bad input, unreachable site, no results) is recoverable
+func NewToolError(tool string, err error) *ToolError {
+	var toolErr *ToolError
+	if errors.As(err, &toolErr) {
+		return toolErr
+	}
+
+	fatal := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		fatal = statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden
+	}
+
+	return &ToolError{Tool: tool, Fatal: fatal, Err: err}
+}
+
+// IsFatal reports whether err must abort the run
+func IsFatal(err error) bool {
+	var toolErr *ToolError
+	if errors.As(err, &toolErr) {
+		return toolErr.Fatal
+	}
+	return err != nil
+}
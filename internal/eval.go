@@ -0,0 +1,472 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// EvalCase is a single question of an evaluation dataset
+type EvalCase struct {
+	ID       string `json:"id"`
+	Question string `json:"question"`
+	// Expected is the expected answer: a string, a regular expression or a number depending on the grader
+	Expected string `json:"expected,omitempty"`
+	// Rubric describes a good answer for the LLM judge
+	Rubric string `json:"rubric,omitempty"`
+	// Grader is exact, regex, numeric or llm. It defaults to exact if Expected is set and to llm otherwise.
+	Grader string `json:"grader,omitempty"`
+	// Tolerance is the allowed absolute difference for the numeric grader
+	Tolerance float64 `json:"tolerance,omitempty"`
+	// Tools lists the tools the agent may use, all tools are allowed if empty
+	Tools []string `json:"tools,omitempty"`
+}
+
+// GraderName returns the grader used for the case
+func (c EvalCase) GraderName() string {
+	if c.Grader != "" {
+		return c.Grader
+	}
+	if c.Expected != "" {
+		return "exact"
+	}
+	return "llm"
+}
+
+// LoadEvalDataset reads eval cases from a JSONL file. Cases without an id get their line number.
+func LoadEvalDataset(path string) ([]EvalCase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset: %w", err)
+	}
+	defer file.Close()
+
+	var cases []EvalCase
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var c EvalCase
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %w", line, err)
+		}
+		if c.Question == "" {
+			return nil, fmt.Errorf("line %d has no question", line)
+		}
+		if c.Expected == "" && c.Rubric == "" {
+			return nil, fmt.Errorf("line %d has neither an expected answer nor a rubric", line)
+		}
+		if c.ID == "" {
+			c.ID = strconv.Itoa(line)
+		}
+		cases = append(cases, c)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dataset: %w", err)
+	}
+
+	return cases, nil
+}
+
+// Grade is the verdict of a grader
+type Grade struct {
+	Pass   bool   `json:"pass"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Grader decides whether an answer is correct
+type Grader interface {
+	Grade(ctx context.Context, c EvalCase, answer string) (Grade, error)
+}
+
+// normalizeAnswer keeps the text after the last "Answer:" in any case (the ReAct agent's final
+// line), lowercases it, trims punctuation and collapses whitespace
+func normalizeAnswer(text string) string {
+	text = strings.ToLower(text)
+	if i := strings.LastIndex(text, "answer:"); i >= 0 {
+		text = text[i+len("answer:"):]
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	return strings.Trim(text, ".!\"' ")
+}
+
+// ExactGrader passes answers equal to the expected one, ignoring case, whitespace and a trailing period
+type ExactGrader struct{}
+
+func (ExactGrader) Grade(ctx context.Context, c EvalCase, answer string) (Grade, error) {
+	if normalizeAnswer(answer) == normalizeAnswer(c.Expected) {
+		return Grade{Pass: true}, nil
+	}
+	return Grade{Reason: fmt.Sprintf("expected %q", c.Expected)}, nil
+}
+
+// RegexGrader passes answers matching the expected regular expression
+type RegexGrader struct{}
+
+func (RegexGrader) Grade(ctx context.Context, c EvalCase, answer string) (Grade, error) {
+	re, err := regexp.Compile(c.Expected)
+	if err != nil {
+		return Grade{}, fmt.Errorf("failed to compile expected pattern: %w", err)
+	}
+
+	if re.MatchString(answer) {
+		return Grade{Pass: true}, nil
+	}
+	return Grade{Reason: fmt.Sprintf("no match for %s", c.Expected)}, nil
+}
+
+// numberTokenRegex matches a lowercased token that is a whole number, e.g. 1,234.5, $12, 15%, 20ms or
+// -3°c, but not a piece of a date, time or version such as 2024-05-01, 12:30 or 1.2.3
+var numberTokenRegex = regexp.MustCompile(`^[$€£]?([-+]?(?:\d{1,3}(?:,\d{3})+|\d+)(?:\.\d+)?)(?:%|°[a-z]?|[a-zµ]+)?$`)
+
+// defaultRelativeTolerance lets numbers without a tolerance differ by rounding errors only
+const defaultRelativeTolerance = 1e-9
+
+// NumericGrader passes final answers with a number within Tolerance of the expected one. Only whole
+// tokens count as numbers, so the pieces of dates, times and versions don't.
+type NumericGrader struct{}
+
+func (NumericGrader) Grade(ctx context.Context, c EvalCase, answer string) (Grade, error) {
+	expected, err := strconv.ParseFloat(strings.TrimSpace(c.Expected), 64)
+	if err != nil {
+		return Grade{}, fmt.Errorf("failed to parse expected number: %w", err)
+	}
+
+	tolerance := c.Tolerance
+	if tolerance == 0 {
+		tolerance = defaultRelativeTolerance * math.Max(1, math.Abs(expected))
+	}
+
+	// Models write negative numbers with the Unicode minus sign as well
+	answer = strings.ReplaceAll(answer, "−", "-")
+
+	for _, token := range strings.Fields(normalizeAnswer(answer)) {
+		match := numberTokenRegex.FindStringSubmatch(strings.Trim(token, `.,;:!?()[]{}"'*`))
+		if match == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.ReplaceAll(match[1], ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		if math.Abs(value-expected) <= tolerance {
+			return Grade{Pass: true}, nil
+		}
+	}
+
+	return Grade{Reason: fmt.Sprintf("no number within %g of %g", tolerance, expected)}, nil
+}
+
+// LLMJudge asks a model whether the answer satisfies the rubric or matches the expected answer
+type LLMJudge struct {
+	client  openai.Client
+	model   string
+	tracker *UsageTracker
+}
+
+// NewLLMJudge creates a judge backed by the given model, recording its usage in tracker
+func NewLLMJudge(client openai.Client, model string, tracker *UsageTracker) *LLMJudge {
+	return &LLMJudge{
+		client:  client,
+		model:   model,
+		tracker: tracker,
+	}
+}
+
+const judgePrompt = `You grade answers of an AI agent.
+Decide whether the answer to the question is correct. If a rubric is given, the answer must satisfy it.
+If an expected answer is given, the answer must agree with it; wording and extra details don't matter.
+Respond with JSON only: {"pass": true or false, "reason": "one sentence"}`
+
+func (j *LLMJudge) Grade(ctx context.Context, c EvalCase, answer string) (Grade, error) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Question: %s\n", c.Question)
+	if c.Expected != "" {
+		fmt.Fprintf(&prompt, "Expected answer: %s\n", c.Expected)
+	}
+	if c.Rubric != "" {
+		fmt.Fprintf(&prompt, "Rubric: %s\n", c.Rubric)
+	}
+	fmt.Fprintf(&prompt, "Answer: %s\n", answer)
+
+	chatCompletion, err := j.client.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage(judgePrompt),
+				openai.UserMessage(prompt.String()),
+			},
+			Model:       j.model,
+			Temperature: openai.Float(0),
+			ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+				OfJSONObject: &openai.ResponseFormatJSONObjectParam{},
+			},
+		},
+	)
+	if err != nil {
+		return Grade{}, fmt.Errorf("failed to judge answer: %w", err)
+	}
+	j.tracker.RecordCompletion("judge", 0, *chatCompletion)
+
+	content, err := CompletionContent(*chatCompletion)
+	if err != nil {
+		return Grade{}, &ModelError{Model: j.model, Err: err}
+	}
+
+	var grade Grade
+	if err := json.Unmarshal([]byte(content), &grade); err != nil {
+		return Grade{}, fmt.Errorf("failed to parse judge verdict: %w", err)
+	}
+
+	return grade, nil
+}
+
+// EvalVariant is an agent variant under evaluation
+type EvalVariant struct {
+	Name string
+	// New creates an answerer for the given options
+	New func(ctx context.Context, options RunOptions) (Answerer, error)
+}
+
+// EvalResult is the outcome of a single case for a single variant
+type EvalResult struct {
+	Variant   string  `json:"variant"`
+	CaseID    string  `json:"case_id"`
+	Question  string  `json:"question"`
+	Answer    string  `json:"answer"`
+	Grader    string  `json:"grader"`
+	Pass      bool    `json:"pass"`
+	Reason    string  `json:"reason,omitempty"`
+	Steps     int     `json:"steps"`
+	Usage     Usage   `json:"usage"`
+	Cost      float64 `json:"cost_usd"`
+	LatencyMs int64   `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// EvalSummary aggregates the results of a variant
+type EvalSummary struct {
+	Variant      string  `json:"variant"`
+	Cases        int     `json:"cases"`
+	Passed       int     `json:"passed"`
+	Errors       int     `json:"errors"`
+	Accuracy     float64 `json:"accuracy"`
+	AvgSteps     float64 `json:"avg_steps"`
+	Cost         float64 `json:"cost_usd"`
+	AvgLatencyMs int64   `json:"avg_latency_ms"`
+}
+
+// EvalReport is the outcome of an evaluation run
+type EvalReport struct {
+	// Prompts is the version of every prompt used, so results can be tied to prompt changes
+	Prompts   map[string]string `json:"prompts"`
+	Summaries []EvalSummary     `json:"summaries"`
+	Results   []EvalResult      `json:"results"`
+}
+
+// Evaluator runs a dataset against agent variants and grades the answers
+type Evaluator struct {
+	graders map[string]Grader
+	// options are the base run options, each case sets the allowed tools
+	options RunOptions
+}
+
+// NewEvaluator creates an evaluator using judge for the llm grader
+func NewEvaluator(options RunOptions, judge Grader) *Evaluator {
+	return &Evaluator{
+		graders: map[string]Grader{
+			"exact":   ExactGrader{},
+			"regex":   RegexGrader{},
+			"numeric": NumericGrader{},
+			"llm":     judge,
+		},
+		options: options,
+	}
+}
+
+// Run answers every case with every variant, one case at a time
+func (e *Evaluator) Run(ctx context.Context, cases []EvalCase, variants []EvalVariant) (EvalReport, error) {
+	var report EvalReport
+
+	library, err := LoadPrompts()
+	if err != nil {
+		return report, err
+	}
+	report.Prompts = library.Versions()
+
+	for _, c := range cases {
+		if _, ok := e.graders[c.GraderName()]; !ok {
+			return report, fmt.Errorf("case %s has unknown grader %s", c.ID, c.GraderName())
+		}
+	}
+
+	for _, variant := range variants {
+		// Cases allowing the same tools share an answerer
+		answerers := make(map[string]Answerer)
+
+		for _, c := range cases {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			Logger("eval").Info("running case", "variant", variant.Name, "case", c.ID)
+
+			key := strings.Join(c.Tools, ",")
+			answerer, ok := answerers[key]
+			if !ok {
+				options := e.options
+				options.Tools = c.Tools
+
+				var err error
+				answerer, err = variant.New(ctx, options)
+				if err != nil {
+					return report, fmt.Errorf("failed to create %s: %w", variant.Name, err)
+				}
+				answerers[key] = answerer
+			}
+
+			report.Results = append(report.Results, e.runCase(ctx, variant.Name, answerer, c))
+		}
+	}
+
+	report.Summaries = summarize(report.Results)
+	return report, nil
+}
+
+// runCase answers and grades a single case
+func (e *Evaluator) runCase(ctx context.Context, variant string, answerer Answerer, c EvalCase) EvalResult {
+	result := EvalResult{
+		Variant:  variant,
+		CaseID:   c.ID,
+		Question: c.Question,
+		Grader:   c.GraderName(),
+	}
+
+	start := time.Now()
+	answer, err := answerer(ctx, c.Question)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.Answer = answer.Text
+	result.Steps = answer.Steps
+	result.Usage = answer.Usage.Usage
+	result.Cost = answer.Usage.Cost
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	grade, err := e.graders[result.Grader].Grade(ctx, c, answer.Text)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Pass = grade.Pass
+	result.Reason = grade.Reason
+
+	return result
+}
+
+// summarize aggregates results per variant, keeping the order variants were run in
+func summarize(results []EvalResult) []EvalSummary {
+	var summaries []EvalSummary
+	index := make(map[string]int)
+	steps := make(map[string]int)
+	latency := make(map[string]int64)
+
+	for _, result := range results {
+		i, ok := index[result.Variant]
+		if !ok {
+			i = len(summaries)
+			index[result.Variant] = i
+			summaries = append(summaries, EvalSummary{Variant: result.Variant})
+		}
+
+		summary := &summaries[i]
+		summary.Cases++
+		if result.Pass {
+			summary.Passed++
+		}
+		if result.Error != "" {
+			summary.Errors++
+		}
+		summary.Cost += result.Cost
+		steps[result.Variant] += result.Steps
+		latency[result.Variant] += result.LatencyMs
+	}
+
+	for i := range summaries {
+		summary := &summaries[i]
+		summary.Accuracy = float64(summary.Passed) / float64(summary.Cases)
+		summary.AvgSteps = float64(steps[summary.Variant]) / float64(summary.Cases)
+		summary.AvgLatencyMs = latency[summary.Variant] / int64(summary.Cases)
+	}
+
+	return summaries
+}
+
+// PrintTable writes the comparison table and the failed cases
+func (r EvalReport) PrintTable(w io.Writer) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "variant\tcases\tpassed\terrors\taccuracy\tavg steps\tcost\tavg latency\t")
+	for _, s := range r.Summaries {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%.0f%%\t%.1f\t$%.4f\t%v\t\n",
+			s.Variant, s.Cases, s.Passed, s.Errors, s.Accuracy*100, s.AvgSteps, s.Cost,
+			(time.Duration(s.AvgLatencyMs) * time.Millisecond).Round(100*time.Millisecond))
+	}
+	table.Flush()
+
+	prompts := make([]string, 0, len(r.Prompts))
+	for name, version := range r.Prompts {
+		prompts = append(prompts, name+"@"+version)
+	}
+	sort.Strings(prompts)
+	fmt.Fprintf(w, "\nPrompts: %s\n", strings.Join(prompts, ", "))
+
+	var failed []EvalResult
+	for _, result := range r.Results {
+		if !result.Pass {
+			failed = append(failed, result)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+
+	sort.SliceStable(failed, func(i, j int) bool { return failed[i].CaseID < failed[j].CaseID })
+	fmt.Fprintln(w, "\nFailed cases:")
+	for _, result := range failed {
+		reason := result.Reason
+		if result.Error != "" {
+			reason = "error: " + result.Error
+		}
+		fmt.Fprintf(w, "  %s %s (%s): %s\n", result.Variant, result.CaseID, result.Grader, reason)
+	}
+}
+
+// WriteReport writes the report as JSON to path
+func (r EvalReport) WriteReport(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal eval report: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write eval report: %w", err)
+	}
+
+	return nil
+}
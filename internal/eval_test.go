@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNormalizeAnswer(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "plain", text: "  Helsinki.  ", want: "helsinki"},
+		{name: "whitespace", text: "New\n  York\tCity!", want: "new york city"},
+		{name: "quoted", text: `"Paris"`, want: "paris"},
+		{name: "final answer", text: "Thought: I know it\nAnswer: Helsinki", want: "helsinki"},
+		{name: "last answer", text: "Answer: Oslo\nObservation: wrong\nAnswer: Helsinki.", want: "helsinki"},
+		{name: "lowercase marker", text: "Thought: done\nanswer: Helsinki", want: "helsinki"},
+		{name: "uppercase marker", text: "ANSWER: Helsinki", want: "helsinki"},
+		{name: "empty", text: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeAnswer(tt.text); got != tt.want {
+				t.Errorf("normalizeAnswer(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraders(t *testing.T) {
+	tests := []struct {
+		name   string
+		grader Grader
+		c      EvalCase
+		answer string
+		want   bool
+	}{
+		{name: "exact", grader: ExactGrader{}, c: EvalCase{Expected: "Helsinki"}, answer: "Answer: helsinki.", want: true},
+		{name: "exact other case of the marker", grader: ExactGrader{}, c: EvalCase{Expected: "Helsinki"}, answer: "answer: HELSINKI", want: true},
+		{name: "exact extra words", grader: ExactGrader{}, c: EvalCase{Expected: "Helsinki"}, answer: "It is Helsinki", want: false},
+		{name: "regex contained", grader: RegexGrader{}, c: EvalCase{Expected: `go1\.\d+`}, answer: "Answer: go version go1.24.0 linux/amd64", want: true},
+		{name: "regex missing", grader: RegexGrader{}, c: EvalCase{Expected: `go1\.\d+`}, answer: "Go is not installed", want: false},
+		{name: "numeric", grader: NumericGrader{}, c: EvalCase{Expected: "42"}, answer: "Answer: 42", want: true},
+		{name: "numeric separators", grader: NumericGrader{}, c: EvalCase{Expected: "1234.5"}, answer: "It costs $1,234.50.", want: true},
+		{name: "numeric percent", grader: NumericGrader{}, c: EvalCase{Expected: "15"}, answer: "Growth was 15%", want: true},
+		{name: "numeric unit", grader: NumericGrader{}, c: EvalCase{Expected: "20"}, answer: "The ping took 20ms", want: true},
+		{name: "numeric celsius", grader: NumericGrader{}, c: EvalCase{Expected: "15"}, answer: "Answer: It is 15°C in Helsinki", want: true},
+		{name: "numeric negative celsius", grader: NumericGrader{}, c: EvalCase{Expected: "-3"}, answer: "Answer: -3°C", want: true},
+		{name: "numeric degrees", grader: NumericGrader{}, c: EvalCase{Expected: "5"}, answer: "About 5° today", want: true},
+		{name: "numeric unicode minus", grader: NumericGrader{}, c: EvalCase{Expected: "-4"}, answer: "Answer: −4 degrees", want: true},
+		{name: "numeric tolerance", grader: NumericGrader{}, c: EvalCase{Expected: "0.02", Tolerance: 0.005}, answer: "Answer: 0.018 seconds", want: true},
+		{name: "numeric outside tolerance", grader: NumericGrader{}, c: EvalCase{Expected: "0.02"}, answer: "Answer: 0.018 seconds", want: false},
+		{name: "numeric date piece", grader: NumericGrader{}, c: EvalCase{Expected: "5"}, answer: "Answer: released on 2024-05-01", want: false},
+		{name: "numeric version piece", grader: NumericGrader{}, c: EvalCase{Expected: "2"}, answer: "Answer: version 1.2.3", want: false},
+		{name: "numeric only final answer", grader: NumericGrader{}, c: EvalCase{Expected: "7"}, answer: "Observation: 7 results\nAnswer: 8", want: false},
+		{name: "numeric lowercase marker", grader: NumericGrader{}, c: EvalCase{Expected: "8"}, answer: "Observation: 7 results\nanswer: 8", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grade, err := tt.grader.Grade(context.Background(), tt.c, tt.answer)
+			if err != nil {
+				t.Fatalf("Grade() error = %v", err)
+			}
+			if grade.Pass != tt.want {
+				t.Errorf("Grade(%q) = %+v, want pass %v", tt.answer, grade, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VectorDocument is a piece of text with its embedding
+type VectorDocument struct {
+	ID     string    `json:"id"`
+	Source string    `json:"source"`
+	Text   string    `json:"text"`
+	Vector []float64 `json:"vector"`
+}
+
+// SearchHit is a document matching a query
+type SearchHit struct {
+	Document VectorDocument
+	Score    float64
+}
+
+// VectorIndex is an in-process vector index with cosine search
+type VectorIndex struct {
+	mu        sync.RWMutex
+	Embedder  string           `json:"embedder"`
+	Documents []VectorDocument `json:"documents"`
+	// Sources holds the SHA-256 of every indexed source's content, to find changed sources
+	Sources map[string]string `json:"sources,omitempty"`
+}
+
+// NewVectorIndex creates an empty index for vectors of the named embedder
+func NewVectorIndex(embedder string) *VectorIndex {
+	return &VectorIndex{Embedder: embedder}
+}
+
+// LoadVectorIndex reads an index saved with Save
+func LoadVectorIndex(path string) (*VectorIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	var index VectorIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse index: %w", err)
+	}
+
+	return &index, nil
+}
+
+// Add appends documents to the index
+func (ix *VectorIndex) Add(documents ...VectorDocument) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.Documents = append(ix.Documents, documents...)
+}
+
+// SourceHash returns the content hash the source was indexed with, empty if it wasn't
+func (ix *VectorIndex) SourceHash(source string) string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return ix.Sources[source]
+}
+
+// IndexedSources returns the sources of the index, sorted
+func (ix *VectorIndex) IndexedSources() []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	seen := make(map[string]bool, len(ix.Sources))
+	for source := range ix.Sources {
+		seen[source] = true
+	}
+	for _, document := range ix.Documents {
+		seen[document.Source] = true
+	}
+
+	sources := make([]string, 0, len(seen))
+	for source := range seen {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// Replace swaps the documents of a source for the ones of its content with the hash
+func (ix *VectorIndex) Replace(source, hash string, documents ...VectorDocument) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.removeLocked(source)
+	ix.Documents = append(ix.Documents, documents...)
+	if ix.Sources == nil {
+		ix.Sources = make(map[string]string)
+	}
+	ix.Sources[source] = hash
+}
+
+// Remove drops the documents of a source
+func (ix *VectorIndex) Remove(source string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.removeLocked(source)
+}
+
+func (ix *VectorIndex) removeLocked(source string) {
+	documents := ix.Documents[:0:0]
+	for _, document := range ix.Documents {
+		if document.Source != source {
+			documents = append(documents, document)
+		}
+	}
+	ix.Documents = documents
+	delete(ix.Sources, source)
+}
+
+// Search returns the k documents most similar to the vector
+func (ix *VectorIndex) Search(vector []float64, k int) []SearchHit {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	hits := make([]SearchHit, 0, len(ix.Documents))
+	for _, document := range ix.Documents {
+		hits = append(hits, SearchHit{Document: document, Score: cosine(vector, document.Vector)})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+// Save writes the index to path as JSON
+func (ix *VectorIndex) Save(path string) error {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	data, err := json.Marshal(ix)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	return nil
+}
+
+// KnowledgeBase answers queries from our own documents
+type KnowledgeBase struct {
+	embedder Embedder
+	index    *VectorIndex
+}
+
+// OpenKnowledgeBase loads the index from indexPath and brings it up to date with the .md and .txt
+// files in dir: new and changed files are indexed again, the chunks of deleted ones are dropped and
+// the index is saved if anything changed. An index of another embedder is rebuilt. No index file is
+// written while there is nothing to index.
+func OpenKnowledgeBase(ctx context.Context, embedder Embedder, dir, indexPath string) (*KnowledgeBase, error) {
+	index, err := LoadVectorIndex(indexPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	existed := err == nil
+	changed := existed && index.Embedder != embedder.Name()
+	if !existed || changed {
+		index = NewVectorIndex(embedder.Name())
+	}
+	kb := &KnowledgeBase{embedder: embedder, index: index}
+
+	// sources of new and changed files, embedded together once the walk is done
+	type pendingSource struct {
+		path, hash string
+		parts      []string
+	}
+	var pending []pendingSource
+
+	found := make(map[string]bool)
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		ext := filepath.Ext(path)
+		if ext != ".md" && ext != ".txt" {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		found[path] = true
+
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		if index.SourceHash(path) != hash {
+			pending = append(pending, pendingSource{path: path, hash: hash, parts: splitText(string(content), 1500)})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to index %s: %w", dir, err)
+	}
+
+	var parts []string
+	for _, source := range pending {
+		parts = append(parts, source.parts...)
+	}
+	vectors, err := embedBatches(ctx, embedder, parts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to index %s: %w", dir, err)
+	}
+	for _, source := range pending {
+		index.Replace(source.path, source.hash, chunkDocuments(source.path, source.parts, vectors[:len(source.parts)])...)
+		vectors = vectors[len(source.parts):]
+		changed = true
+	}
+
+	for _, source := range index.IndexedSources() {
+		if !found[source] {
+			index.Remove(source)
+			changed = true
+		}
+	}
+
+	if changed && (existed || len(index.IndexedSources()) > 0) {
+		if err := index.Save(indexPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return kb, nil
+}
+
+// OpenKnowledgeBaseFromEnv opens the knowledge base in KNOWLEDGE_DIR (default "knowledge")
+// with its index at KNOWLEDGE_INDEX (default "knowledge_index.json")
+func OpenKnowledgeBaseFromEnv(ctx context.Context, tracker *UsageTracker) (*KnowledgeBase, error) {
+	dir := os.Getenv("KNOWLEDGE_DIR")
+	if dir == "" {
+		dir = "knowledge"
+	}
+
+	indexPath := os.Getenv("KNOWLEDGE_INDEX")
+	if indexPath == "" {
+		indexPath = "knowledge_index.json"
+	}
+
+	return OpenKnowledgeBase(ctx, NewEmbedderFromEnv(tracker), dir, indexPath)
+}
+
+// AddText splits the text into chunks, embeds and indexes them
+func (kb *KnowledgeBase) AddText(ctx context.Context, source, text string) error {
+	documents, err := kb.chunks(ctx, source, text)
+	if err != nil {
+		return err
+	}
+	kb.index.Add(documents...)
+
+	return nil
+}
+
+// chunks splits the text of a source into chunks and embeds them
+func (kb *KnowledgeBase) chunks(ctx context.Context, source, text string) ([]VectorDocument, error) {
+	parts := splitText(text, 1500)
+	vectors, err := embedBatches(ctx, kb.embedder, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	return chunkDocuments(source, parts, vectors), nil
+}
+
+// chunkDocuments pairs the chunks of a source with their vectors
+func chunkDocuments(source string, parts []string, vectors [][]float64) []VectorDocument {
+	documents := make([]VectorDocument, len(parts))
+	for i, part := range parts {
+		documents[i] = VectorDocument{
+			ID:     fmt.Sprintf("%s#%d", source, i+1),
+			Source: source,
+			Text:   part,
+			Vector: vectors[i],
+		}
+	}
+	return documents
+}
+
+// embedBatchSize is the number of texts embedded per request
+const embedBatchSize = 100
+
+// embedBatches embeds texts in requests of up to embedBatchSize texts
+func embedBatches(ctx context.Context, embedder Embedder, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch, err := embedder.Embed(ctx, texts[start:min(start+embedBatchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+
+	return vectors, nil
+}
+
+// Search returns the k chunks most relevant to the query
+func (kb *KnowledgeBase) Search(ctx context.Context, query string, k int) ([]SearchHit, error) {
+	vectors, err := kb.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	return kb.index.Search(vectors[0], k), nil
+}
+
+// FormatHits renders search hits for an observation
+func FormatHits(hits []SearchHit) string {
+	if len(hits) == 0 {
+		return "No matching documents found"
+	}
+
+	var result strings.Builder
+	for _, hit := range hits {
+		result.WriteString(fmt.Sprintf("[%s] (score %.2f) %s\n", hit.Document.ID, hit.Score, hit.Document.Text))
+	}
+	return result.String()
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+// ToolCall is a function call requested by the model
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolDefinition describes a function the model may call
+type ToolDefinition struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments
+	Parameters map[string]any
+}
+
+// ChatRequest is a single chat completion request
+type ChatRequest struct {
+	Model       string
+	Messages    []Message
+	Tools       []ToolDefinition
+	Temperature *float64
+	// Agent and Step attribute the usage and the model span
+	Agent string
+	Step  int
+}
+
+// ChatModel is a chat completion API with function calling
+type ChatModel interface {
+	// Chat returns the assistant message. A message cut off at the token limit
+	// is returned along with ErrTruncated.
+	Chat(ctx context.Context, request ChatRequest) (Message, error)
+}
+
+// OpenAIChatModel is a ChatModel calling the OpenAI API, recording usage in a tracker
+type OpenAIChatModel struct {
+	client  openai.Client
+	tracker *UsageTracker
+}
+
+// NewOpenAIChatModel creates a chat model recording its usage in tracker
+func NewOpenAIChatModel(client openai.Client, tracker *UsageTracker) *OpenAIChatModel {
+	return &OpenAIChatModel{client: client, tracker: tracker}
+}
+
+func (m *OpenAIChatModel) Chat(ctx context.Context, request ChatRequest) (message Message, err error) {
+	params := openai.ChatCompletionNewParams{
+		Messages: ToOpenAI(request.Messages),
+		Model:    request.Model,
+	}
+	if request.Temperature != nil {
+		params.Temperature = openai.Float(*request.Temperature)
+	}
+	for _, tool := range request.Tools {
+		params.Tools = append(params.Tools, openai.ChatCompletionToolParam{
+			Function: shared.FunctionDefinitionParam{
+				Name:        tool.Name,
+				Description: openai.String(tool.Description),
+				Parameters:  shared.FunctionParameters(tool.Parameters),
+			},
+		})
+	}
+
+	ctx, span := StartSpan(ctx, SpanModel, request.Model)
+	span.SetAttribute("agent", request.Agent)
+	span.SetAttribute("step", request.Step)
+	if TracingEnabled(ctx) {
+		messages, _ := json.Marshal(request.Messages)
+		span.Input = string(messages)
+	}
+	defer func() {
+		span.Output = message.Content
+		for _, call := range message.ToolCalls {
+			span.Output += "\n" + call.Name + "(" + call.Arguments + ")"
+		}
+		span.Finish(err)
+	}()
+
+	completion, err := m.client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return Message{}, &ModelError{Model: request.Model, Step: request.Step, Err: err}
+	}
+	m.tracker.RecordCompletion(request.Agent, request.Step, *completion)
+	span.SetAttribute("prompt_tokens", completion.Usage.PromptTokens)
+	span.SetAttribute("completion_tokens", completion.Usage.CompletionTokens)
+
+	content, err := CompletionContent(*completion)
+	if err != nil && !errors.Is(err, ErrTruncated) {
+		return Message{}, &ModelError{Model: request.Model, Step: request.Step, Err: err}
+	}
+
+	message = Message{Role: "assistant", Content: content, Name: request.Agent}
+	for _, call := range completion.Choices[0].Message.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+
+	if err != nil {
+		return message, &ModelError{Model: request.Model, Step: request.Step, Err: err}
+	}
+	return message, nil
+}
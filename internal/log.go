@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// LogOptions configures logging
+type LogOptions struct {
+	// Level is debug, info, warn or error
+	Level string
+	// Format is text or json
+	Format string
+	// Quiet only logs errors
+	Quiet bool
+}
+
+// LogOptionsFromEnv reads LOG_LEVEL, LOG_FORMAT and LOG_QUIET
+func LogOptionsFromEnv() LogOptions {
+	return LogOptions{
+		Level:  os.Getenv("LOG_LEVEL"),
+		Format: os.Getenv("LOG_FORMAT"),
+		Quiet:  os.Getenv("LOG_QUIET") == "1",
+	}
+}
+
+// SetupLogging installs the default slog logger writing to out, which should not be stdout
+// as that's where answers go. Secrets are redacted from every message and attribute.
+func SetupLogging(out io.Writer, options LogOptions) error {
+	level := slog.LevelInfo
+	if options.Level != "" {
+		if err := level.UnmarshalText([]byte(options.Level)); err != nil {
+			return fmt.Errorf("unknown log level: %s", options.Level)
+		}
+	}
+	if options.Quiet {
+		level = slog.LevelError
+	}
+
+	handlerOptions := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}
+
+	var handler slog.Handler
+	switch options.Format {
+	case "", "text":
+		handler = slog.NewTextHandler(out, handlerOptions)
+	case "json":
+		handler = slog.NewJSONHandler(out, handlerOptions)
+	default:
+		return fmt.Errorf("unknown log format: %s", options.Format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// Logger returns the logger of a component, e.g. search, scraper, agent or tool
+func Logger(component string) *slog.Logger {
+	return slog.Default().With("component", component)
+}
+
+// secretKeys matches attribute keys whose values are always redacted. Token counts such as
+// prompt_tokens aren't secrets, so only a bare token and named kinds of tokens match.
+var secretKeys = regexp.MustCompile(`(?i)(api[_-]?key|^token$|(access|refresh|auth|api)[_-]?token|secret|password|authorization)`)
+
+// secretPatterns matches secrets embedded in messages and values
+var secretPatterns = regexp.MustCompile(`(sk-[A-Za-z0-9_-]{16,}|(?i:bearer)\s+[A-Za-z0-9._-]{16,})`)
+
+// secretEnv lists environment variables whose values never appear in logs
+var secretEnv = []string{"OPENAI_API_KEY", "RAPIDAPI_KEY"}
+
+// Redact replaces known secrets in text
+func Redact(text string) string {
+	for _, name := range secretEnv {
+		if value := os.Getenv(name); len(value) >= 8 {
+			text = strings.ReplaceAll(text, value, "[REDACTED]")
+		}
+	}
+	return secretPatterns.ReplaceAllString(text, "[REDACTED]")
+}
+
+// redactAttr redacts an attribute, and every attribute of a group named like a secret. Handlers
+// call it for the attributes in groups, a group value it's given is walked.
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key != slog.MessageKey && secretKeys.MatchString(attr.Key) {
+		return slog.String(attr.Key, "[REDACTED]")
+	}
+	for _, group := range groups {
+		if secretKeys.MatchString(group) {
+			return slog.String(attr.Key, "[REDACTED]")
+		}
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindGroup:
+		members := attr.Value.Group()
+		redacted := make([]slog.Attr, len(members))
+		for i, member := range members {
+			redacted[i] = redactAttr(append(groups[:len(groups):len(groups)], attr.Key), member)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindString:
+		return slog.String(attr.Key, Redact(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, Redact(err.Error()))
+		}
+	}
+
+	return attr
+}
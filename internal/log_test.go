@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestRedactAttr(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		attr   slog.Attr
+		want   string
+	}{
+		{name: "plain", attr: slog.String("query", "weather in Helsinki"), want: "query=weather in Helsinki"},
+		{name: "api key", attr: slog.String("api_key", "abc"), want: "api_key=[REDACTED]"},
+		{name: "bare token", attr: slog.String("Token", "abc"), want: "Token=[REDACTED]"},
+		{name: "access token", attr: slog.String("access-token", "abc"), want: "access-token=[REDACTED]"},
+		{name: "authorization", attr: slog.String("Authorization", "Basic abc"), want: "Authorization=[REDACTED]"},
+		{name: "token counts", attr: slog.Int("prompt_tokens", 120), want: "prompt_tokens=120"},
+		{name: "max tokens", attr: slog.Int("max_tokens", 4096), want: "max_tokens=4096"},
+		{name: "secret in value", attr: slog.String("header", "Bearer abcdefghijklmnopqrstuvwxyz"), want: "header=[REDACTED]"},
+		{name: "key in value", attr: slog.String("output", "key sk-abcdefghijklmnopqrstuvwxyz leaked"), want: "output=key [REDACTED] leaked"},
+		{name: "in a secret group", groups: []string{"request", "auth_token"}, attr: slog.String("value", "abc"), want: "value=[REDACTED]"},
+		{name: "in a plain group", groups: []string{"usage"}, attr: slog.Int("completion_tokens", 80), want: "completion_tokens=80"},
+		{
+			name: "group value",
+			attr: slog.Group("request", slog.String("url", "https://example.com"), slog.String("password", "abc"), slog.Group("secret", slog.String("id", "abc"))),
+			want: "request=[url=https://example.com password=[REDACTED] secret=[REDACTED]]",
+		},
+		{name: "group named like a secret", attr: slog.Group("secrets", slog.String("id", "abc")), want: "secrets=[REDACTED]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactAttr(tt.groups, tt.attr).String(); got != tt.want {
+				t.Errorf("redactAttr() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,476 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	_ "modernc.org/sqlite" // pure Go sqlite driver, so the binary builds without cgo
+)
+
+// SessionStore persists conversation messages by session id
+type SessionStore interface {
+	Load(ctx context.Context, sessionID string) ([]Message, error)
+	Append(ctx context.Context, sessionID string, messages ...Message) error
+	Clear(ctx context.Context, sessionID string) error
+}
+
+// NewSessionID returns a new, time based session id
+func NewSessionID() string {
+	return time.Now().Format("20060102-150405.000")
+}
+
+// NewSessionStoreFromEnv creates the store selected by SESSION_STORE (memory, json or sqlite)
+// located at SESSION_PATH
+func NewSessionStoreFromEnv() (SessionStore, error) {
+	path := os.Getenv("SESSION_PATH")
+
+	switch os.Getenv("SESSION_STORE") {
+	case "", "json":
+		if path == "" {
+			path = "sessions"
+		}
+		return NewJSONSessionStore(path), nil
+	case "sqlite":
+		if path == "" {
+			path = "sessions.db"
+		}
+		return NewSQLiteSessionStore(path)
+	case "memory":
+		return NewMemorySessionStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown session store: %s", os.Getenv("SESSION_STORE"))
+	}
+}
+
+// MemorySessionStore keeps sessions in memory, they are lost when the process exits
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string][]Message
+}
+
+// NewMemorySessionStore creates an empty in-memory store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string][]Message)}
+}
+
+func (s *MemorySessionStore) Load(ctx context.Context, sessionID string) ([]Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Message(nil), s.sessions[sessionID]...), nil
+}
+
+func (s *MemorySessionStore) Append(ctx context.Context, sessionID string, messages ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[sessionID] = append(s.sessions[sessionID], messages...)
+	return nil
+}
+
+func (s *MemorySessionStore) Clear(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+// JSONSessionStore keeps every session in its own JSON file in a directory
+type JSONSessionStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewJSONSessionStore creates a store writing to dir
+func NewJSONSessionStore(dir string) *JSONSessionStore {
+	return &JSONSessionStore{dir: dir}
+}
+
+// path returns the file of the session, rejecting ids that would lead outside dir
+func (s *JSONSessionStore) path(sessionID string) (string, error) {
+	if sessionID == "" || sessionID == "." || strings.Contains(sessionID, "..") || strings.ContainsAny(sessionID, `/\`) {
+		return "", fmt.Errorf("invalid session id %q", sessionID)
+	}
+	return filepath.Join(s.dir, sessionID+".json"), nil
+}
+
+func (s *JSONSessionStore) Load(ctx context.Context, sessionID string) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load(sessionID)
+}
+
+func (s *JSONSessionStore) load(sessionID string) ([]Message, error) {
+	path, err := s.path(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var messages []Message
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, fmt.Errorf("failed to parse session: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (s *JSONSessionStore) Append(ctx context.Context, sessionID string, messages ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.load(sessionID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(append(existing, messages...), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	path, err := s.path(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+
+	return nil
+}
+
+func (s *JSONSessionStore) Clear(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(sessionID)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove session: %w", err)
+	}
+
+	return nil
+}
+
+// SQLiteSessionStore keeps sessions in a SQLite database
+type SQLiteSessionStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteSessionStore opens (and creates if needed) the database at path
+func NewSQLiteSessionStore(path string) (*SQLiteSessionStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session database: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS session_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		content TEXT NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create session table: %w", err)
+	}
+
+	return &SQLiteSessionStore{db: db}, nil
+}
+
+func (s *SQLiteSessionStore) Load(ctx context.Context, sessionID string) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT role, content FROM session_messages WHERE session_id = ? ORDER BY id`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var message Message
+		if err := rows.Scan(&message.Role, &message.Content); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+func (s *SQLiteSessionStore) Append(ctx context.Context, sessionID string, messages ...Message) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, message := range messages {
+		_, err := tx.ExecContext(ctx, `INSERT INTO session_messages (session_id, role, content) VALUES (?, ?, ?)`, sessionID, message.Role, message.Content)
+		if err != nil {
+			return fmt.Errorf("failed to insert message: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteSessionStore) Clear(ctx context.Context, sessionID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM session_messages WHERE session_id = ?`, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to clear session: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *SQLiteSessionStore) Close() error {
+	return s.db.Close()
+}
+
+// MemoryStrategy selects what part of a session history is sent to the model
+type MemoryStrategy interface {
+	Recall(ctx context.Context, history []Message) ([]Message, error)
+}
+
+// BufferStrategy recalls the last MaxMessages messages, or all of them if MaxMessages is 0
+type BufferStrategy struct {
+	MaxMessages int
+}
+
+func (b BufferStrategy) Recall(ctx context.Context, history []Message) ([]Message, error) {
+	if b.MaxMessages > 0 && len(history) > b.MaxMessages {
+		return history[len(history)-b.MaxMessages:], nil
+	}
+	return history, nil
+}
+
+// SummaryBufferStrategy recalls the latest messages up to MaxTokens verbatim
+// and replaces everything older with a summary
+type SummaryBufferStrategy struct {
+	Tokenizer  Tokenizer
+	Summarizer Summarizer
+	MaxTokens  int
+
+	// the summary is cached, so it's only regenerated when the summarized part of the history changes
+	transcript string
+	summary    string
+}
+
+func (b *SummaryBufferStrategy) Recall(ctx context.Context, history []Message) ([]Message, error) {
+	start := len(history)
+	var tokens int
+	for start > 0 {
+		tokens += b.Tokenizer.Count(history[start-1].Content)
+		if tokens > b.MaxTokens {
+			break
+		}
+		start--
+	}
+
+	if start == 0 {
+		return history, nil
+	}
+
+	var transcript string
+	for _, message := range history[:start] {
+		transcript += fmt.Sprintf("%s: %s\n", message.Role, message.Content)
+	}
+
+	if transcript != b.transcript {
+		summary, err := b.Summarizer.Summarize(ctx, transcript, b.MaxTokens)
+		if err != nil {
+			return nil, err
+		}
+		b.transcript = transcript
+		b.summary = summary
+	}
+
+	return append([]Message{{Role: "system", Content: "Summary of the earlier conversation: " + b.summary}}, history[start:]...), nil
+}
+
+// Session is a conversation that can be resumed later by its id
+type Session struct {
+	ID       string
+	store    SessionStore
+	strategy MemoryStrategy
+}
+
+// NewSession creates a session, resuming it if the store already has messages for the id
+func NewSession(id string, store SessionStore, strategy MemoryStrategy) *Session {
+	return &Session{
+		ID:       id,
+		store:    store,
+		strategy: strategy,
+	}
+}
+
+// NewSessionFromEnv resumes the session in SESSION_ID or starts a new one.
+// MEMORY_STRATEGY selects "buffer" (default) or "summary" buffer memory.
+func NewSessionFromEnv(store SessionStore, tokenizer Tokenizer, summarizer Summarizer) *Session {
+	id := os.Getenv("SESSION_ID")
+	if id == "" {
+		id = NewSessionID()
+	}
+
+	var strategy MemoryStrategy = BufferStrategy{MaxMessages: 20}
+	if os.Getenv("MEMORY_STRATEGY") == "summary" {
+		strategy = &SummaryBufferStrategy{
+			Tokenizer:  tokenizer,
+			Summarizer: summarizer,
+			MaxTokens:  2000,
+		}
+	}
+
+	return NewSession(id, store, strategy)
+}
+
+// Recall returns the history the strategy selected for the next query
+func (s *Session) Recall(ctx context.Context) ([]Message, error) {
+	history, err := s.store.Load(ctx, s.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.strategy.Recall(ctx, history)
+}
+
+// Reset starts a new, empty session with the same store and strategy
+func (s *Session) Reset() {
+	s.ID = NewSessionID()
+}
+
+// History returns the full stored history of the session
+func (s *Session) History(ctx context.Context) ([]Message, error) {
+	return s.store.Load(ctx, s.ID)
+}
+
+// Export writes the full history of the session to a JSON file
+func (s *Session) Export(ctx context.Context, path string) error {
+	history, err := s.History(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+
+	return nil
+}
+
+// Import starts a new session with the history from a file written by Export
+func (s *Session) Import(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var history []Message
+	if err := json.Unmarshal(data, &history); err != nil {
+		return fmt.Errorf("failed to parse session: %w", err)
+	}
+
+	s.Reset()
+	return s.Append(ctx, history...)
+}
+
+// Append stores new messages in the session
+func (s *Session) Append(ctx context.Context, messages ...Message) error {
+	return s.store.Append(ctx, s.ID, messages...)
+}
+
+// Session implements langchaingo's schema.ChatMessageHistory,
+// so it can back langchaingo memory.
+
+// Messages returns the recalled history as langchaingo messages
+func (s *Session) Messages(ctx context.Context) ([]llms.ChatMessage, error) {
+	messages, err := s.Recall(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chatMessages := make([]llms.ChatMessage, 0, len(messages))
+	for _, message := range messages {
+		switch message.Role {
+		case "system":
+			chatMessages = append(chatMessages, llms.SystemChatMessage{Content: message.Content})
+		case "assistant":
+			chatMessages = append(chatMessages, llms.AIChatMessage{Content: message.Content})
+		default:
+			chatMessages = append(chatMessages, llms.HumanChatMessage{Content: message.Content})
+		}
+	}
+
+	return chatMessages, nil
+}
+
+func (s *Session) AddMessage(ctx context.Context, message llms.ChatMessage) error {
+	role := "user"
+	switch message.GetType() {
+	case llms.ChatMessageTypeAI:
+		role = "assistant"
+	case llms.ChatMessageTypeSystem:
+		role = "system"
+	}
+
+	return s.Append(ctx, Message{Role: role, Content: message.GetContent()})
+}
+
+func (s *Session) AddUserMessage(ctx context.Context, text string) error {
+	return s.Append(ctx, Message{Role: "user", Content: text})
+}
+
+func (s *Session) AddAIMessage(ctx context.Context, text string) error {
+	return s.Append(ctx, Message{Role: "assistant", Content: text})
+}
+
+func (s *Session) Clear(ctx context.Context) error {
+	return s.store.Clear(ctx, s.ID)
+}
+
+func (s *Session) SetMessages(ctx context.Context, messages []llms.ChatMessage) error {
+	if err := s.Clear(ctx); err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if err := s.AddMessage(ctx, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,294 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// Chunk is a piece of a scraped page small enough to fit into the conversation
+type Chunk struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Index int    `json:"index"`
+	Text  string `json:"text"`
+}
+
+// Page is a scraped page split into chunks, with where and when it came from
+type Page struct {
+	ID     string  `json:"id"`
+	URL    string  `json:"url"`
+	Chunks []Chunk `json:"chunks"`
+	// Title, Fetched and Hash, the SHA-256 of the scraped content, are only known for scraped pages
+	Title   string    `json:"title,omitempty"`
+	Fetched time.Time `json:"fetched,omitempty"`
+	Hash    string    `json:"hash,omitempty"`
+}
+
+// Overview returns a short description of the page to show the agent instead of its full text
+func (p *Page) Overview(previewChars int) string {
+	var overview strings.Builder
+
+	overview.WriteString(fmt.Sprintf("Page %s (%s) stored as %d chunks.\n", p.ID, p.URL, len(p.Chunks)))
+	if p.Title != "" {
+		overview.WriteString(fmt.Sprintf("Title: %s\n", p.Title))
+	}
+	if len(p.Chunks) > 0 {
+		preview := p.Chunks[0].Text
+		if len(preview) > previewChars {
+			preview = strings.ToValidUTF8(preview[:previewChars], "") + "..."
+		}
+		overview.WriteString(fmt.Sprintf("Beginning of the page: %s\n", preview))
+	}
+
+	ids := make([]string, 0, len(p.Chunks))
+	for _, chunk := range p.Chunks {
+		ids = append(ids, chunk.ID)
+	}
+	overview.WriteString(fmt.Sprintf("Chunk ids: %s", strings.Join(ids, ", ")))
+
+	return overview.String()
+}
+
+// PageStore keeps the pages scraped during a single run
+type PageStore struct {
+	mu        sync.RWMutex
+	chunkSize int
+	pages     map[string]*Page
+	chunks    map[string]Chunk
+}
+
+// NewPageStore creates a store splitting pages into chunks of about chunkSize characters
+func NewPageStore(chunkSize int) *PageStore {
+	return &PageStore{
+		chunkSize: chunkSize,
+		pages:     make(map[string]*Page),
+		chunks:    make(map[string]Chunk),
+	}
+}
+
+// Scrape fetches the URL with the scraper and stores its text
+func (s *PageStore) Scrape(scraper *ScraperClient, url string) (*Page, error) {
+	content, err := scraper.Scrape(url)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256([]byte(content))
+	return s.add(&Page{
+		URL:     url,
+		Title:   ExtractTitle(content),
+		Fetched: time.Now().UTC(),
+		Hash:    hex.EncodeToString(hash[:]),
+	}, ExtractText(content)), nil
+}
+
+// Add splits the text into chunks and stores it as a new page
+func (s *PageStore) Add(url, text string) *Page {
+	return s.add(&Page{URL: url}, text)
+}
+
+func (s *PageStore) add(page *Page, text string) *Page {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	url := page.URL
+	page.ID = fmt.Sprintf("p%d", len(s.pages)+1)
+
+	for i, part := range splitText(text, s.chunkSize) {
+		chunk := Chunk{
+			ID:    fmt.Sprintf("%s#%d", page.ID, i+1),
+			URL:   url,
+			Index: i,
+			Text:  part,
+		}
+		page.Chunks = append(page.Chunks, chunk)
+		s.chunks[chunk.ID] = chunk
+	}
+
+	s.pages[page.ID] = page
+	return page
+}
+
+// Page returns a stored page by id
+func (s *PageStore) Page(id string) (*Page, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	page, ok := s.pages[id]
+	return page, ok
+}
+
+// Chunk returns a stored chunk by id
+func (s *PageStore) Chunk(id string) (Chunk, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chunk, ok := s.chunks[strings.TrimSpace(id)]
+	return chunk, ok
+}
+
+// Find returns up to limit chunks of the page that best match the query keywords. Chunks are
+// scored by how often they contain the exact words of the query, ignoring case, so synonyms
+// and other forms of a word don't match.
+func (s *PageStore) Find(pageID, query string, limit int) ([]Chunk, error) {
+	page, ok := s.Page(pageID)
+	if !ok {
+		return nil, fmt.Errorf("unknown page: %s", pageID)
+	}
+
+	keywords := tokenize(query)
+
+	type scored struct {
+		chunk Chunk
+		score int
+	}
+
+	var matches []scored
+	for _, chunk := range page.Chunks {
+		words := tokenize(chunk.Text)
+
+		var score int
+		for _, keyword := range keywords {
+			for _, word := range words {
+				if word == keyword {
+					score++
+				}
+			}
+		}
+
+		if score > 0 {
+			matches = append(matches, scored{chunk: chunk, score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	var chunks []Chunk
+	for i := 0; i < len(matches) && i < limit; i++ {
+		chunks = append(chunks, matches[i].chunk)
+	}
+
+	return chunks, nil
+}
+
+// FormatChunks renders chunks for an observation
+func FormatChunks(chunks []Chunk) string {
+	if len(chunks) == 0 {
+		return "No matching chunks found"
+	}
+
+	var result strings.Builder
+	for _, chunk := range chunks {
+		result.WriteString(fmt.Sprintf("[%s] %s\n", chunk.ID, chunk.Text))
+	}
+	return result.String()
+}
+
+// ExtractTitle returns the title of an HTML document, or the first heading of a Markdown one
+func ExtractTitle(content string) string {
+	if !strings.Contains(content, "<") {
+		for _, line := range strings.Split(content, "\n") {
+			if title, ok := strings.CutPrefix(strings.TrimSpace(line), "# "); ok {
+				return strings.TrimSpace(title)
+			}
+		}
+		return ""
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(content))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "title" && tokenizer.Next() == html.TextToken {
+				return strings.Join(strings.Fields(string(tokenizer.Text())), " ")
+			}
+		}
+	}
+}
+
+// ExtractText returns the visible text of an HTML document, or the input as is if it isn't HTML
+func ExtractText(content string) string {
+	if !strings.Contains(content, "<") {
+		return content
+	}
+
+	var text strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(content))
+	var skip int
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(text.String()), " ")
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			switch {
+			case string(name) == "body":
+				// An unclosed head or a stray tag before it must not hide the body
+				skip = 0
+			case isInvisibleTag(string(name)):
+				skip++
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if isInvisibleTag(string(name)) && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				text.Write(tokenizer.Text())
+				text.WriteString(" ")
+			}
+		}
+	}
+}
+
+func isInvisibleTag(name string) bool {
+	switch name {
+	case "script", "style", "noscript", "svg", "head":
+		return true
+	}
+	return false
+}
+
+// splitText splits text into parts of about size characters on word boundaries
+func splitText(text string, size int) []string {
+	var parts []string
+	var part strings.Builder
+
+	for _, word := range strings.Fields(text) {
+		if part.Len() > 0 && part.Len()+len(word)+1 > size {
+			parts = append(parts, part.String())
+			part.Reset()
+		}
+		if part.Len() > 0 {
+			part.WriteString(" ")
+		}
+		part.WriteString(word)
+	}
+
+	if part.Len() > 0 {
+		parts = append(parts, part.String())
+	}
+
+	return parts
+}
+
+// tokenize lowercases text and splits it into words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// embeddedPrompts are the built-in prompts, stored as prompts/<name>/v<version>.tmpl
+//
+//go:embed prompts
+var embeddedPrompts embed.FS
+
+// Prompt is a named and versioned prompt template
+type Prompt struct {
+	Name    string
+	Version string
+
+	tmpl *template.Template
+}
+
+// ID identifies the prompt and its version, e.g. react@v2
+func (p *Prompt) ID() string {
+	return p.Name + "@" + p.Version
+}
+
+// Render executes the template with vars, usually PromptVars plus prompt specific variables.
+// Surrounding whitespace is trimmed.
+func (p *Prompt) Render(vars map[string]any) (string, error) {
+	var text strings.Builder
+	if err := p.tmpl.Execute(&text, vars); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", p.ID(), err)
+	}
+
+	return strings.TrimSpace(text.String()), nil
+}
+
+// ParsePrompt parses a prompt template that isn't part of the library, e.g. inline instructions
+func ParsePrompt(name, version, text string) (*Prompt, error) {
+	tmpl, err := template.New(name + "@" + version).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt %s@%s: %w", name, version, err)
+	}
+
+	return &Prompt{Name: name, Version: version, tmpl: tmpl}, nil
+}
+
+// PromptVars returns the variables every prompt may use: the current Date,
+// the user's Locale (USER_LOCALE or LANG) and the enabled Tools
+func PromptVars(tools []string) map[string]any {
+	locale := os.Getenv("USER_LOCALE")
+	if locale == "" {
+		locale, _, _ = strings.Cut(os.Getenv("LANG"), ".")
+	}
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		locale = "en_US"
+	}
+
+	return map[string]any{
+		"Date":   time.Now().Format("Monday, 2 January 2006"),
+		"Locale": locale,
+		"Tools":  tools,
+	}
+}
+
+// PromptLibrary holds every version of every prompt
+type PromptLibrary struct {
+	// prompts are sorted from the oldest to the latest version
+	prompts map[string][]*Prompt
+	// pinned selects a version other than the latest
+	pinned map[string]string
+}
+
+// LoadPrompts loads the built-in prompts and the ones in PROMPT_DIR, which override built-in
+// prompts of the same name and version, and the deprecated AGENT_PROMPT. PROMPT_VERSIONS pins
+// versions, e.g. "react=v1,swarm_writer=v1", otherwise the latest version of each prompt is used.
+func LoadPrompts() (*PromptLibrary, error) {
+	library := &PromptLibrary{
+		prompts: make(map[string][]*Prompt),
+		pinned:  make(map[string]string),
+	}
+
+	embedded, err := fs.Sub(embeddedPrompts, "prompts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open built-in prompts: %w", err)
+	}
+	if err := library.load(embedded); err != nil {
+		return nil, err
+	}
+
+	if dir := os.Getenv("PROMPT_DIR"); dir != "" {
+		if err := library.load(os.DirFS(dir)); err != nil {
+			return nil, err
+		}
+	}
+
+	// AGENT_PROMPT replaced the react template before prompts were versioned, it's kept as the latest version
+	if file := os.Getenv("AGENT_PROMPT"); file != "" {
+		if err := library.loadLatest("react", file); err != nil {
+			return nil, err
+		}
+		Logger("prompts").Warn("AGENT_PROMPT is deprecated, put the template in PROMPT_DIR as react/v<version>.tmpl", "file", file)
+	}
+
+	for _, pin := range strings.Split(os.Getenv("PROMPT_VERSIONS"), ",") {
+		if strings.TrimSpace(pin) == "" {
+			continue
+		}
+		name, version, ok := strings.Cut(strings.TrimSpace(pin), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid prompt version %q, expected name=version", pin)
+		}
+		library.pinned[name] = version
+	}
+
+	return library, nil
+}
+
+// load parses every <name>/<version>.tmpl file in fsys
+func (l *PromptLibrary) load(fsys fs.FS) error {
+	paths, err := fs.Glob(fsys, "*/*.tmpl")
+	if err != nil {
+		return fmt.Errorf("failed to list prompts: %w", err)
+	}
+
+	for _, file := range paths {
+		name := path.Dir(file)
+		version := strings.TrimSuffix(path.Base(file), ".tmpl")
+		if _, err := versionNumber(version); err != nil {
+			return fmt.Errorf("invalid version of prompt %s: %w", file, err)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt %s: %w", file, err)
+		}
+
+		prompt, err := ParsePrompt(name, version, string(data))
+		if err != nil {
+			return err
+		}
+		l.add(prompt)
+	}
+
+	return nil
+}
+
+// loadLatest parses the template file as a new latest version of the prompt
+func (l *PromptLibrary) loadLatest(name, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read prompt %s: %w", file, err)
+	}
+
+	var latest int
+	if versions := l.prompts[name]; len(versions) > 0 {
+		latest, _ = versionNumber(versions[len(versions)-1].Version)
+	}
+	prompt, err := ParsePrompt(name, "v"+strconv.Itoa(latest+1), string(data))
+	if err != nil {
+		return err
+	}
+	l.add(prompt)
+	return nil
+}
+
+// add adds a prompt, replacing the one with the same name and version
+func (l *PromptLibrary) add(prompt *Prompt) {
+	versions := l.prompts[prompt.Name]
+	for i, existing := range versions {
+		if existing.Version == prompt.Version {
+			versions[i] = prompt
+			return
+		}
+	}
+
+	versions = append(versions, prompt)
+	sort.Slice(versions, func(i, j int) bool {
+		a, _ := versionNumber(versions[i].Version)
+		b, _ := versionNumber(versions[j].Version)
+		return a < b
+	})
+	l.prompts[prompt.Name] = versions
+}
+
+// versionNumber parses a version like v2
+func versionNumber(version string) (int, error) {
+	number, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil || !strings.HasPrefix(version, "v") {
+		return 0, fmt.Errorf("expected a version like v1, got %q", version)
+	}
+	return number, nil
+}
+
+// Get returns the pinned or else the latest version of a prompt
+func (l *PromptLibrary) Get(name string) (*Prompt, error) {
+	versions := l.prompts[name]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("unknown prompt: %s", name)
+	}
+
+	pinned, ok := l.pinned[name]
+	if !ok {
+		return versions[len(versions)-1], nil
+	}
+
+	for _, prompt := range versions {
+		if prompt.Version == pinned {
+			return prompt, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown version %s of prompt %s", pinned, name)
+}
+
+// Versions returns the version used of every prompt, e.g. for reports
+func (l *PromptLibrary) Versions() map[string]string {
+	versions := make(map[string]string, len(l.prompts))
+	for name := range l.prompts {
+		if prompt, err := l.Get(name); err == nil {
+			versions[name] = prompt.Version
+		}
+	}
+	return versions
+}
+
+// PromptIDs joins the ids of prompts for a trace attribute
+func PromptIDs(prompts ...*Prompt) string {
+	ids := make([]string, len(prompts))
+	for i, prompt := range prompts {
+		ids[i] = prompt.ID()
+	}
+	return strings.Join(ids, ",")
+}
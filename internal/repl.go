@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Command is a slash command available in the REPL
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	Run         func(ctx context.Context, args []string) error
+}
+
+// REPL is an interactive prompt running every input through an agent.
+// Ctrl-C cancels only the run in progress, Ctrl-D or /exit quits.
+type REPL struct {
+	prompt   string
+	in       *bufio.Reader
+	out      io.Writer
+	run      func(ctx context.Context, input string) error
+	commands map[string]Command
+	history  []string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// NewREPL creates a REPL reading from stdin and running inputs with run
+func NewREPL(prompt string, run func(ctx context.Context, input string) error) *REPL {
+	r := &REPL{
+		prompt:   prompt,
+		in:       bufio.NewReader(os.Stdin),
+		out:      os.Stdout,
+		run:      run,
+		commands: make(map[string]Command),
+	}
+
+	r.AddCommand(Command{
+		Name:        "help",
+		Usage:       "/help",
+		Description: "Show available commands",
+		Run: func(ctx context.Context, args []string) error {
+			r.printHelp()
+			return nil
+		},
+	})
+	r.AddCommand(Command{
+		Name:        "history",
+		Usage:       "/history",
+		Description: "Show inputs of this REPL session",
+		Run: func(ctx context.Context, args []string) error {
+			for i, input := range r.history {
+				fmt.Fprintf(r.out, "%3d  %s\n", i+1, input)
+			}
+			return nil
+		},
+	})
+
+	return r
+}
+
+// AddCommand registers a slash command, replacing any command with the same name
+func (r *REPL) AddCommand(command Command) {
+	r.commands[command.Name] = command
+}
+
+// Run reads inputs until /exit, end of input or ctx is done. Every input runs in a context
+// derived from ctx, so it keeps the tracer of ctx and stops with it.
+func (r *REPL) Run(ctx context.Context) error {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	go func() {
+		for range interrupts {
+			r.mu.Lock()
+			if r.cancel != nil {
+				fmt.Fprintln(r.out, "\nCancelling current run...")
+				r.cancel()
+			} else {
+				fmt.Fprintf(r.out, "\n(use /exit or Ctrl-D to quit)\n%s", r.prompt)
+			}
+			r.mu.Unlock()
+		}
+	}()
+
+	fmt.Fprintln(r.out, `Type a question, end a line with \ or wrap it in """ for multi-line input, /help for commands.`)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		input, err := r.readInput()
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(r.out)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		r.history = append(r.history, input)
+
+		if input == "/exit" || input == "/quit" {
+			return nil
+		}
+
+		inputCtx, cancel := context.WithCancel(ctx)
+		r.mu.Lock()
+		r.cancel = cancel
+		r.mu.Unlock()
+
+		if strings.HasPrefix(input, "/") {
+			err = r.runCommand(inputCtx, input)
+		} else {
+			err = r.run(inputCtx, input)
+		}
+
+		r.mu.Lock()
+		r.cancel = nil
+		r.mu.Unlock()
+		cancel()
+
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(r.out, "Run cancelled")
+		} else if err != nil {
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+		}
+	}
+}
+
+// readInput reads a single input, joining continuation lines and """ blocks
+func (r *REPL) readInput() (string, error) {
+	fmt.Fprint(r.out, r.prompt)
+
+	var lines []string
+	var block bool
+
+	for {
+		line, err := r.in.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.TrimSpace(line) == `"""`:
+			if block {
+				return strings.Join(lines, "\n"), nil
+			}
+			block = true
+		case block:
+			lines = append(lines, line)
+		case strings.HasSuffix(line, `\`):
+			lines = append(lines, strings.TrimSuffix(line, `\`))
+		default:
+			return strings.Join(append(lines, line), "\n"), nil
+		}
+
+		fmt.Fprint(r.out, "... ")
+	}
+}
+
+func (r *REPL) runCommand(ctx context.Context, input string) error {
+	fields := strings.Fields(strings.TrimPrefix(input, "/"))
+	if len(fields) == 0 {
+		return errors.New("unknown command, see /help")
+	}
+	command, ok := r.commands[fields[0]]
+	if !ok {
+		return fmt.Errorf("unknown command /%s, see /help", fields[0])
+	}
+
+	return command.Run(ctx, fields[1:])
+}
+
+func (r *REPL) printHelp() {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		command := r.commands[name]
+		fmt.Fprintf(r.out, "  %-20s %s\n", command.Usage, command.Description)
+	}
+	fmt.Fprintf(r.out, "  %-20s %s\n", "/exit", "Quit")
+}
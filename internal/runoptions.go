@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// RunOptions configures a run of any of the agent variants
+type RunOptions struct {
+	// Queries to answer, one run each
+	Queries []string
+	// Model overrides the variant's default model if set
+	Model string
+	// Temperature is used only if set, otherwise the provider default applies
+	Temperature *float64
+	// MaxIter limits the agent loop iterations
+	MaxIter int
+	// Tools lists the enabled tools, all tools are enabled if empty
+	Tools []string
+	// Output is the result format, "text" or "json"
+	Output string
+	// Interactive starts a REPL instead of running Queries
+	Interactive bool
+	// Quiet prints only the results to stdout, without streamed output, progress or usage
+	Quiet bool
+}
+
+// ModelOr returns the configured model or the given default
+func (o RunOptions) ModelOr(model string) string {
+	if o.Model != "" {
+		return o.Model
+	}
+	return model
+}
+
+// ToolEnabled reports whether the tool may be used in this run
+func (o RunOptions) ToolEnabled(name string) bool {
+	if len(o.Tools) == 0 {
+		return true
+	}
+
+	for _, tool := range o.Tools {
+		if tool == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Console returns where to print streamed output, progress and usage: stdout, stderr when stdout
+// carries JSON results, or nowhere in quiet mode
+func (o RunOptions) Console() io.Writer {
+	switch {
+	case o.Quiet:
+		return io.Discard
+	case o.Output == "json":
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// QueriesOr returns the configured queries or the given defaults
+func (o RunOptions) QueriesOr(queries ...string) []string {
+	if len(o.Queries) > 0 {
+		return o.Queries
+	}
+	return queries
+}
+
+// LoadQueries reads queries from a file, one per line. Empty lines and lines starting with # are skipped.
+func LoadQueries(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queries file: %w", err)
+	}
+	defer file.Close()
+
+	var queries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		queries = append(queries, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read queries file: %w", err)
+	}
+
+	return queries, nil
+}
+
+// RunResult is the outcome of answering a single query
+type RunResult struct {
+	Query  string `json:"query"`
+	Answer string `json:"answer"`
+	Error  string `json:"error,omitempty"`
+}
+
+// PrintResult writes the result in the given output format
+func PrintResult(w io.Writer, format string, result RunResult) {
+	if format == "json" {
+		data, _ := json.Marshal(result)
+		fmt.Fprintln(w, string(data))
+		return
+	}
+
+	if result.Error != "" {
+		fmt.Fprintf(w, "Error: %s\n", result.Error)
+		return
+	}
+	fmt.Fprintln(w, "Result:", result.Answer)
+}
@@ -61,6 +61,8 @@ func (s *ScraperClient) Scrape(targetURL string) (string, error) {
 	req.Header.Add("x-rapidapi-host", s.apiHost)
 	req.Header.Add("Content-Type", "application/json")
 
+	Logger("scraper").Debug("scraping", "url", targetURL)
+
 	// Execute request
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -70,7 +72,7 @@ func (s *ScraperClient) Scrape(targetURL string) (string, error) {
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return "", &StatusError{Service: "scraper", StatusCode: resp.StatusCode}
 	}
 
 	// Read body
@@ -83,6 +85,7 @@ func (s *ScraperClient) Scrape(targetURL string) (string, error) {
 	var scrapeResp ScrapeResponse
 	if err := json.Unmarshal(body, &scrapeResp); err != nil {
 		// If parsing fails, just return the raw body
+		Logger("scraper").Debug("unexpected scrape response, using the raw body", "url", targetURL, "error", err)
 		return string(body), nil
 	}
 
@@ -53,6 +53,8 @@ func (s *SearchClient) Search(query string) ([]SearchResult, error) {
 	req.Header.Add("x-rapidapi-key", os.Getenv("RAPIDAPI_KEY"))
 	req.Header.Add("x-rapidapi-host", s.apiHost)
 
+	Logger("search").Debug("searching", "query", query)
+
 	// Execute request
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -62,7 +64,7 @@ func (s *SearchClient) Search(query string) ([]SearchResult, error) {
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &StatusError{Service: "search", StatusCode: resp.StatusCode}
 	}
 
 	// Read body
@@ -77,5 +79,6 @@ func (s *SearchClient) Search(query string) ([]SearchResult, error) {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	Logger("search").Debug("search done", "query", query, "results", len(searchResponse.Results))
 	return searchResponse.Results, nil
 }
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/openai/openai-go"
+)
+
+// StreamHandler receives model output incrementally while a completion is streamed
+type StreamHandler interface {
+	// OnToken is called with every content delta as soon as it arrives
+	OnToken(token string)
+	// OnLine is called with every completed line of content.
+	// Returning true stops the completion, e.g. once the model pauses for an action to run.
+	OnLine(line string) bool
+}
+
+// StreamChatCompletion streams a chat completion, forwarding deltas to the handler,
+// and returns the accumulated completion. A completion stopped by the handler ends with the
+// line that stopped it, the rest isn't generated, and its usage is estimated with the
+// model's tokenizer, as the usage chunk only comes at the end of the stream.
+func StreamChatCompletion(ctx context.Context, client openai.Client, params openai.ChatCompletionNewParams, handler StreamHandler) (completion openai.ChatCompletion, err error) {
+	params.StreamOptions.IncludeUsage = openai.Bool(true)
+
+	ctx, span := StartSpan(ctx, SpanModel, params.Model)
+	if TracingEnabled(ctx) {
+		messages, _ := json.Marshal(params.Messages)
+		span.Input = string(messages)
+	}
+	defer func() {
+		if len(completion.Choices) > 0 {
+			span.Output = completion.Choices[0].Message.Content
+		}
+		span.SetAttribute("prompt_tokens", completion.Usage.PromptTokens)
+		span.SetAttribute("completion_tokens", completion.Usage.CompletionTokens)
+		span.Finish(err)
+	}()
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream := client.Chat.Completions.NewStreaming(streamCtx, params)
+	defer stream.Close()
+
+	acc := openai.ChatCompletionAccumulator{}
+	// content is the content up to the last completed line
+	var content, line strings.Builder
+	var stopped bool
+
+	for !stopped && stream.Next() {
+		chunk := stream.Current()
+		acc.AddChunk(chunk)
+
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		token := chunk.Choices[0].Delta.Content
+		if token == "" {
+			continue
+		}
+		handler.OnToken(token)
+
+		// Emit every completed line, keeping the unfinished tail buffered
+		line.WriteString(token)
+		for {
+			buffered := line.String()
+			idx := strings.IndexByte(buffered, '\n')
+			if idx < 0 {
+				break
+			}
+			line.Reset()
+			line.WriteString(buffered[idx+1:])
+			content.WriteString(buffered[:idx+1])
+
+			if handler.OnLine(buffered[:idx]) {
+				// Stop generating, the rest of the completion would be billed but never used
+				stopped = true
+				cancel()
+				break
+			}
+		}
+	}
+
+	if stopped {
+		span.SetAttribute("usage_estimated", true)
+		return stoppedCompletion(acc.ChatCompletion, params, strings.TrimSuffix(content.String(), "\n")), nil
+	}
+	if err := stream.Err(); err != nil {
+		return acc.ChatCompletion, fmt.Errorf("failed to stream completion: %w", err)
+	}
+
+	if line.Len() > 0 {
+		handler.OnLine(line.String())
+	}
+
+	return acc.ChatCompletion, nil
+}
+
+// stoppedCompletion returns the completion stopped after content, with its usage estimated
+func stoppedCompletion(completion openai.ChatCompletion, params openai.ChatCompletionNewParams, content string) openai.ChatCompletion {
+	if completion.Model == "" {
+		completion.Model = params.Model
+	}
+	if len(completion.Choices) == 0 {
+		completion.Choices = []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant"}}}
+	}
+	completion.Choices[0].Message.Content = content
+	completion.Choices[0].FinishReason = "stop"
+
+	// The messages are counted as JSON, which roughly makes up for the tokens framing each message
+	tokenizer := streamTokenizer(params.Model)
+	messages, _ := json.Marshal(params.Messages)
+	completion.Usage = openai.CompletionUsage{
+		PromptTokens:     int64(tokenizer.Count(string(messages))),
+		CompletionTokens: int64(tokenizer.Count(content)),
+	}
+	completion.Usage.TotalTokens = completion.Usage.PromptTokens + completion.Usage.CompletionTokens
+	return completion
+}
+
+// streamTokenizers are the tokenizers of the models of stopped completions, loaded once
+var streamTokenizers sync.Map
+
+func streamTokenizer(model string) Tokenizer {
+	if tokenizer, ok := streamTokenizers.Load(model); ok {
+		return tokenizer.(Tokenizer)
+	}
+	tokenizer, _ := streamTokenizers.LoadOrStore(model, NewTokenizer(model))
+	return tokenizer.(Tokenizer)
+}
+
+// TerminalStreamHandler renders streamed tokens to a terminal as they arrive
+type TerminalStreamHandler struct {
+	out io.Writer
+}
+
+// NewTerminalStreamHandler creates a handler that writes tokens to out
+func NewTerminalStreamHandler(out io.Writer) *TerminalStreamHandler {
+	return &TerminalStreamHandler{out: out}
+}
+
+// OnToken writes the token as is
+func (h *TerminalStreamHandler) OnToken(token string) {
+	fmt.Fprint(h.out, token)
+}
+
+// OnLine never stops the stream
+func (h *TerminalStreamHandler) OnLine(line string) bool {
+	return false
+}
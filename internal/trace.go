@@ -0,0 +1,406 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span kinds
+const (
+	SpanRun     = "run"
+	SpanModel   = "model"
+	SpanTool    = "tool"
+	SpanAgent   = "agent"
+	SpanHandoff = "handoff"
+	SpanNode    = "node"
+	SpanState   = "state"
+)
+
+// Span is a timed operation of an agent run. Spans of the same run share a trace id.
+type Span struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Kind       string         `json:"kind"`
+	Name       string         `json:"name"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Input      string         `json:"input,omitempty"`
+	Output     string         `json:"output,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+
+	tracer *Tracer
+}
+
+// SetAttribute sets an attribute, e.g. the model or token counts
+func (s *Span) SetAttribute(key string, value any) {
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]any)
+	}
+	s.Attributes[key] = value
+}
+
+// Finish ends the span now, recording err if it's not nil, and exports it
+func (s *Span) Finish(err error) {
+	s.FinishAt(time.Now(), err)
+}
+
+// FinishAt ends the span at the given time, for operations timed by someone else
+func (s *Span) FinishAt(end time.Time, err error) {
+	s.End = end
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	if s.tracer != nil {
+		s.tracer.export(*s)
+	}
+}
+
+// SpanExporter receives finished spans
+type SpanExporter interface {
+	Export(span Span) error
+	// Close flushes buffered spans
+	Close() error
+}
+
+// Tracer passes finished spans to its exporters
+type Tracer struct {
+	mu        sync.Mutex
+	exporters []SpanExporter
+}
+
+// NewTracer creates a tracer exporting to the given exporters
+func NewTracer(exporters ...SpanExporter) *Tracer {
+	return &Tracer{exporters: exporters}
+}
+
+// NewTracerFromEnv creates a tracer configured by the environment:
+// tool calls are logged unless TRACE_LOG=0, TRACE_FILE appends all spans as JSONL
+// and OTEL_EXPORTER_OTLP_ENDPOINT (e.g. http://localhost:4318) sends them to an OpenTelemetry collector
+func NewTracerFromEnv() (*Tracer, error) {
+	var exporters []SpanExporter
+
+	if os.Getenv("TRACE_LOG") != "0" {
+		exporters = append(exporters, LogExporter{})
+	}
+
+	if path := os.Getenv("TRACE_FILE"); path != "" {
+		exporter, err := NewJSONLExporter(path)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		exporters = append(exporters, NewOTLPExporter(endpoint, "agents"))
+	}
+
+	return NewTracer(exporters...), nil
+}
+
+func (t *Tracer) export(span Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, exporter := range t.exporters {
+		if err := exporter.Export(span); err != nil {
+			Logger("trace").Error("failed to export span", "error", err)
+		}
+	}
+}
+
+// Close flushes and closes all exporters
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []string
+	for _, exporter := range t.exporters {
+		if err := exporter.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close span exporters: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+type tracerKey struct{}
+type spanKey struct{}
+
+// ContextWithTracer returns a context whose spans are exported by tracer
+func ContextWithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// TracingEnabled reports whether spans started from ctx are exported
+func TracingEnabled(ctx context.Context) bool {
+	tracer, _ := ctx.Value(tracerKey{}).(*Tracer)
+	return tracer != nil
+}
+
+// StartSpan starts a span that is a child of the span in ctx, if any.
+// Without a tracer in ctx the span is still usable but never exported.
+func StartSpan(ctx context.Context, kind, name string) (context.Context, *Span) {
+	return StartSpanAt(ctx, kind, name, time.Now())
+}
+
+// StartSpanAt starts a span at the given time
+func StartSpanAt(ctx context.Context, kind, name string, start time.Time) (context.Context, *Span) {
+	tracer, _ := ctx.Value(tracerKey{}).(*Tracer)
+
+	span := &Span{
+		SpanID: newID(8),
+		Kind:   kind,
+		Name:   name,
+		Start:  start,
+		tracer: tracer,
+	}
+
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else {
+		span.TraceID = newID(16)
+	}
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// newID returns a random hex id of n bytes, as used by OpenTelemetry
+func newID(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// LogExporter logs a line per tool call and failed span
+type LogExporter struct{}
+
+func (LogExporter) Export(span Span) error {
+	if span.Kind != SpanTool && span.Error == "" {
+		return nil
+	}
+
+	args := []any{"kind", span.Kind, "name", span.Name, "input", truncate(span.Input, 200), "duration", span.End.Sub(span.Start).Round(time.Millisecond)}
+	if agent, ok := span.Attributes["agent"]; ok {
+		args = append(args, "agent", agent)
+	}
+
+	if span.Error != "" {
+		Logger(span.Kind).Warn("span failed", append(args, "error", span.Error)...)
+		return nil
+	}
+	Logger(span.Kind).Info("tool call", args...)
+	return nil
+}
+
+func (LogExporter) Close() error {
+	return nil
+}
+
+// truncate shortens text to at most n characters on a single line
+func truncate(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) > n {
+		return string(runes[:n]) + "..."
+	}
+	return text
+}
+
+// JSONLExporter appends every span as a JSON line to a file
+type JSONLExporter struct {
+	file *os.File
+}
+
+// NewJSONLExporter opens path for appending
+func NewJSONLExporter(path string) (*JSONLExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+
+	return &JSONLExporter{file: file}, nil
+}
+
+func (e *JSONLExporter) Export(span Span) error {
+	data, err := json.Marshal(span)
+	if err != nil {
+		return fmt.Errorf("failed to marshal span: %w", err)
+	}
+
+	_, err = e.file.Write(append(data, '\n'))
+	return err
+}
+
+func (e *JSONLExporter) Close() error {
+	return e.file.Close()
+}
+
+// LoadSpans reads spans written by a JSONLExporter
+func LoadSpans(path string) ([]Span, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace file: %w", err)
+	}
+
+	var spans []Span
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var span Span
+		if err := json.Unmarshal(line, &span); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %w", i+1, err)
+		}
+		spans = append(spans, span)
+	}
+
+	return spans, nil
+}
+
+// otlpBatchSize is the number of spans sent to the collector in one request
+const otlpBatchSize = 100
+
+// OTLPExporter sends spans to an OpenTelemetry collector with OTLP/HTTP JSON
+type OTLPExporter struct {
+	url     string
+	service string
+	client  *http.Client
+	spans   []Span
+}
+
+// NewOTLPExporter creates an exporter sending to endpoint/v1/traces
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	return &OTLPExporter{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *OTLPExporter) Export(span Span) error {
+	e.spans = append(e.spans, span)
+	if len(e.spans) < otlpBatchSize {
+		return nil
+	}
+	return e.flush()
+}
+
+func (e *OTLPExporter) Close() error {
+	return e.flush()
+}
+
+func (e *OTLPExporter) flush() error {
+	if len(e.spans) == 0 {
+		return nil
+	}
+	spans := e.spans
+	e.spans = nil
+
+	body, err := json.Marshal(otlpRequest(e.service, spans))
+	if err != nil {
+		return fmt.Errorf("failed to marshal spans: %w", err)
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send spans: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to send spans: collector returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+// otlpRequest builds an ExportTraceServiceRequest in the OTLP JSON encoding
+func otlpRequest(service string, spans []Span) map[string]any {
+	otlpSpans := make([]map[string]any, 0, len(spans))
+	for _, span := range spans {
+		attributes := []map[string]any{
+			otlpAttribute("agent.span.kind", span.Kind),
+		}
+		if span.Input != "" {
+			attributes = append(attributes, otlpAttribute("agent.input", span.Input))
+		}
+		if span.Output != "" {
+			attributes = append(attributes, otlpAttribute("agent.output", span.Output))
+		}
+		for key, value := range span.Attributes {
+			attributes = append(attributes, otlpAttribute(key, value))
+		}
+
+		status := map[string]any{"code": 1}
+		if span.Error != "" {
+			status = map[string]any{"code": 2, "message": span.Error}
+		}
+
+		otlpSpan := map[string]any{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Kind + " " + span.Name,
+			"kind":              1,
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        attributes,
+			"status":            status,
+		}
+		if span.ParentID != "" {
+			otlpSpan["parentSpanId"] = span.ParentID
+		}
+		otlpSpans = append(otlpSpans, otlpSpan)
+	}
+
+	return map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{
+				"attributes": []map[string]any{otlpAttribute("service.name", service)},
+			},
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]any{"name": service},
+				"spans": otlpSpans,
+			}},
+		}},
+	}
+}
+
+// otlpAttribute encodes a key value pair as an OTLP attribute
+func otlpAttribute(key string, value any) map[string]any {
+	var encoded map[string]any
+	switch v := value.(type) {
+	case string:
+		encoded = map[string]any{"stringValue": v}
+	case bool:
+		encoded = map[string]any{"boolValue": v}
+	case int:
+		encoded = map[string]any{"intValue": strconv.Itoa(v)}
+	case int64:
+		encoded = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		encoded = map[string]any{"doubleValue": v}
+	default:
+		encoded = map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+
+	return map[string]any{"key": key, "value": encoded}
+}
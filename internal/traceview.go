@@ -0,0 +1,339 @@
+package internal
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TraceRun is a run reconstructed from the spans of a trace
+type TraceRun struct {
+	TraceID  string
+	Source   string
+	Variant  string
+	Prompt   string
+	Query    string
+	Answer   string
+	Error    string
+	Start    time.Time
+	Duration time.Duration
+	Tokens   int64
+	Steps    []TraceStep
+}
+
+// TraceStep is a span of a run positioned on the run's timeline
+type TraceStep struct {
+	Span
+	Depth    int
+	Duration time.Duration
+	Tokens   int64
+	// Offset and Width are percentages of the run duration
+	Offset float64
+	Width  float64
+}
+
+// Label describes the step in a single line, used for the timeline and diffs
+func (s TraceStep) Label() string {
+	label := s.Kind + " " + s.Name
+	if agent, ok := s.Attributes["agent"].(string); ok && agent != "" && s.Kind != SpanAgent {
+		label = agent + ": " + label
+	}
+	return label
+}
+
+// BuildTraceRuns groups spans by trace into runs, ordered by start time
+func BuildTraceRuns(source string, spans []Span) []TraceRun {
+	byTrace := make(map[string][]Span)
+	var order []string
+	for _, span := range spans {
+		if _, ok := byTrace[span.TraceID]; !ok {
+			order = append(order, span.TraceID)
+		}
+		byTrace[span.TraceID] = append(byTrace[span.TraceID], span)
+	}
+
+	var runs []TraceRun
+	for _, traceID := range order {
+		runs = append(runs, buildTraceRun(source, traceID, byTrace[traceID]))
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Start.Before(runs[j].Start) })
+	return runs
+}
+
+func buildTraceRun(source, traceID string, spans []Span) TraceRun {
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+
+	run := TraceRun{TraceID: traceID, Source: source}
+	ids := make(map[string]bool)
+	var end time.Time
+	for _, span := range spans {
+		ids[span.SpanID] = true
+		if run.Start.IsZero() || span.Start.Before(run.Start) {
+			run.Start = span.Start
+		}
+		if span.End.After(end) {
+			end = span.End
+		}
+	}
+	run.Duration = end.Sub(run.Start)
+
+	// The root span describes the run, spans whose parent is missing are shown at the top level
+	depths := make(map[string]int)
+	for _, span := range spans {
+		if span.Kind == SpanRun && !ids[span.ParentID] {
+			run.Variant = span.Name
+			run.Prompt, _ = span.Attributes["prompt"].(string)
+			run.Query = span.Input
+			run.Answer = span.Output
+			run.Error = span.Error
+			continue
+		}
+
+		depth := 0
+		if parentDepth, ok := depths[span.ParentID]; ok {
+			depth = parentDepth + 1
+		}
+		depths[span.SpanID] = depth
+
+		step := TraceStep{
+			Span:     span,
+			Depth:    depth,
+			Duration: span.End.Sub(span.Start),
+			Tokens:   attributeInt(span.Attributes, "prompt_tokens") + attributeInt(span.Attributes, "completion_tokens"),
+		}
+		if run.Duration > 0 {
+			step.Offset = 100 * float64(span.Start.Sub(run.Start)) / float64(run.Duration)
+			step.Width = 100 * float64(step.Duration) / float64(run.Duration)
+		}
+		run.Tokens += step.Tokens
+		run.Steps = append(run.Steps, step)
+	}
+
+	return run
+}
+
+// attributeInt reads a numeric attribute, which is a float64 after a JSON round trip
+func attributeInt(attributes map[string]any, key string) int64 {
+	switch v := attributes[key].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	}
+	return 0
+}
+
+// DiffLine is a line of a diff, Op is "=", "-" or "+"
+type DiffLine struct {
+	Op   string
+	Text string
+}
+
+// TraceDiff compares two runs of the same query
+type TraceDiff struct {
+	Query  string
+	A, B   TraceRun
+	Steps  []DiffLine
+	Answer []DiffLine
+}
+
+// DiffTraceRuns pairs the first two runs of every query and diffs their steps and answers
+func DiffTraceRuns(runs []TraceRun) []TraceDiff {
+	byQuery := make(map[string][]TraceRun)
+	var queries []string
+	for _, run := range runs {
+		if _, ok := byQuery[run.Query]; !ok {
+			queries = append(queries, run.Query)
+		}
+		byQuery[run.Query] = append(byQuery[run.Query], run)
+	}
+
+	var diffs []TraceDiff
+	for _, query := range queries {
+		pair := byQuery[query]
+		if len(pair) < 2 {
+			continue
+		}
+
+		diffs = append(diffs, TraceDiff{
+			Query:  query,
+			A:      pair[0],
+			B:      pair[1],
+			Steps:  diffLines(stepLabels(pair[0]), stepLabels(pair[1])),
+			Answer: diffLines(strings.Split(pair[0].Answer, "\n"), strings.Split(pair[1].Answer, "\n")),
+		})
+	}
+
+	return diffs
+}
+
+// stepLabels lists the tool calls, agent steps and handoffs of a run with their inputs
+func stepLabels(run TraceRun) []string {
+	var labels []string
+	for _, step := range run.Steps {
+		if step.Kind == SpanModel {
+			continue
+		}
+		labels = append(labels, step.Label()+" "+truncate(step.Input, 120))
+	}
+	return labels
+}
+
+// diffLines computes a line diff from the longest common subsequence
+func diffLines(a, b []string) []DiffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{Op: "=", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{Op: "+", Text: b[j]})
+	}
+
+	return diff
+}
+
+// WriteTraceHTML renders runs and their diffs as a self-contained HTML page
+func WriteTraceHTML(w io.Writer, runs []TraceRun, diffs []TraceDiff) error {
+	tmpl, err := template.New("trace").Funcs(template.FuncMap{
+		"duration": func(d time.Duration) string {
+			return d.Round(time.Millisecond).String()
+		},
+		"pct": func(f float64) string {
+			return fmt.Sprintf("%.2f%%", f)
+		},
+		"indent": func(depth int) string {
+			return fmt.Sprintf("%dem", depth)
+		},
+		"short": func(text string) string {
+			return truncate(text, 100)
+		},
+	}).Parse(traceTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse trace template: %w", err)
+	}
+
+	if err := tmpl.Execute(w, map[string]any{"Runs": runs, "Diffs": diffs}); err != nil {
+		return fmt.Errorf("failed to render trace: %w", err)
+	}
+
+	return nil
+}
+
+// RenderTraceFiles renders the runs of the given trace files to an HTML file at outPath
+func RenderTraceFiles(outPath string, paths ...string) error {
+	var runs []TraceRun
+	for _, path := range paths {
+		spans, err := LoadSpans(path)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, BuildTraceRuns(path, spans)...)
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create trace page: %w", err)
+	}
+	defer out.Close()
+
+	return WriteTraceHTML(out, runs, DiffTraceRuns(runs))
+}
+
+const traceTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Agent runs</title>
+<style>
+body { font-family: -apple-system, sans-serif; margin: 2em; color: #222; }
+h2 { margin-top: 2em; border-bottom: 1px solid #ddd; }
+.meta { color: #666; font-size: 0.9em; }
+.error { color: #c00; }
+.row { display: flex; align-items: center; border-top: 1px solid #f0f0f0; }
+.label { width: 40%; padding: 2px 0; font-size: 0.9em; }
+.lane { position: relative; width: 60%; height: 1.2em; background: #fafafa; }
+.bar { position: absolute; top: 2px; bottom: 2px; min-width: 2px; border-radius: 2px; }
+.run { background: #999; } .model { background: #4a90d9; } .tool { background: #e8a33d; }
+.agent { background: #7b61c9; } .handoff { background: #d33; } .node { background: #3a9d7a; } .state { background: #c9a227; }
+details { margin: 0 0 0.5em 2em; font-size: 0.9em; }
+pre { white-space: pre-wrap; background: #f6f6f6; padding: 0.5em; max-height: 30em; overflow: auto; }
+.diff div { font-family: monospace; white-space: pre-wrap; }
+.diff .del { background: #fdd; } .diff .add { background: #dfd; }
+</style>
+</head>
+<body>
+<h1>Agent runs</h1>
+{{range .Runs}}
+<h2>{{.Variant}}: {{short .Query}}</h2>
+<p class="meta">{{.Source}} · trace {{.TraceID}} · {{.Start.Format "2006-01-02 15:04:05"}} · {{duration .Duration}} · {{.Tokens}} tokens · {{len .Steps}} spans{{if .Prompt}} · prompt {{.Prompt}}{{end}}</p>
+{{if .Error}}<p class="error">Error: {{.Error}}</p>{{end}}
+{{range .Steps}}
+<div class="row">
+  <div class="label" style="padding-left: {{indent .Depth}}">{{.Label}} · {{duration .Duration}}{{if .Tokens}} · {{.Tokens}} tokens{{end}}{{if .Error}} <span class="error">✗</span>{{end}}</div>
+  <div class="lane"><div class="bar {{.Kind}}" style="left: {{pct .Offset}}; width: {{pct .Width}}"></div></div>
+</div>
+{{if or .Input .Output .Error}}
+<details>
+  <summary>{{short .Input}}</summary>
+  {{if .Input}}<p>Input</p><pre>{{.Input}}</pre>{{end}}
+  {{if .Output}}<p>Output</p><pre>{{.Output}}</pre>{{end}}
+  {{if .Error}}<p class="error">Error</p><pre>{{.Error}}</pre>{{end}}
+</details>
+{{end}}
+{{end}}
+<details open>
+  <summary>Answer</summary>
+  <pre>{{.Answer}}</pre>
+</details>
+{{end}}
+{{if .Diffs}}
+<h1>Diffs</h1>
+{{range .Diffs}}
+<h2>{{short .Query}}</h2>
+<p class="meta">- {{.A.Variant}} {{.A.Source}} {{.A.Prompt}} ({{.A.Start.Format "15:04:05"}}, {{duration .A.Duration}}, {{.A.Tokens}} tokens)
+<br>+ {{.B.Variant}} {{.B.Source}} {{.B.Prompt}} ({{.B.Start.Format "15:04:05"}}, {{duration .B.Duration}}, {{.B.Tokens}} tokens)</p>
+<h3>Steps</h3>
+<div class="diff">{{range .Steps}}<div class="{{if eq .Op "-"}}del{{else if eq .Op "+"}}add{{end}}">{{.Op}} {{.Text}}</div>{{end}}</div>
+<h3>Answer</h3>
+<div class="diff">{{range .Answer}}<div class="{{if eq .Op "-"}}del{{else if eq .Op "+"}}add{{end}}">{{.Op}} {{.Text}}</div>{{end}}</div>
+{{end}}
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,426 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// Usage holds token counts reported by a model call
+type Usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	CachedTokens     int64 `json:"cached_tokens"`
+}
+
+// Add returns the sum of two usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		CachedTokens:     u.CachedTokens + other.CachedTokens,
+	}
+}
+
+// ModelPrice is the price of a model in USD per 1M tokens
+type ModelPrice struct {
+	Input       float64 `json:"input"`
+	CachedInput float64 `json:"cached_input"`
+	Output      float64 `json:"output"`
+}
+
+// PriceTable maps model names (or name prefixes) to their prices
+type PriceTable map[string]ModelPrice
+
+// DefaultPriceTable returns list prices for the models used in this repository
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		"gpt-4o":       {Input: 2.50, CachedInput: 1.25, Output: 10.00},
+		"gpt-4o-mini":  {Input: 0.15, CachedInput: 0.075, Output: 0.60},
+		"gpt-4.1":      {Input: 2.00, CachedInput: 0.50, Output: 8.00},
+		"gpt-4.1-mini": {Input: 0.40, CachedInput: 0.10, Output: 1.60},
+		"gpt-4.1-nano": {Input: 0.10, CachedInput: 0.025, Output: 0.40},
+
+		"text-embedding-3-small": {Input: 0.02},
+		"text-embedding-3-large": {Input: 0.13},
+	}
+}
+
+// LoadPriceTable reads a JSON price table from path and merges it over the defaults
+func LoadPriceTable(path string) (PriceTable, error) {
+	prices := DefaultPriceTable()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+
+	var overrides PriceTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse price table: %w", err)
+	}
+
+	for model, price := range overrides {
+		prices[model] = price
+	}
+
+	return prices, nil
+}
+
+// Cost calculates the price of the usage in USD.
+// Models are matched by the longest known prefix, so "gpt-4o-2024-08-06" uses the "gpt-4o" price.
+func (p PriceTable) Cost(model string, usage Usage) float64 {
+	var match string
+	for name := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(match) {
+			match = name
+		}
+	}
+	if match == "" {
+		return 0
+	}
+
+	price := p[match]
+	uncached := usage.PromptTokens - usage.CachedTokens
+
+	return (float64(uncached)*price.Input +
+		float64(usage.CachedTokens)*price.CachedInput +
+		float64(usage.CompletionTokens)*price.Output) / 1_000_000
+}
+
+// UsageRecord is the usage of a single model call
+type UsageRecord struct {
+	Agent string  `json:"agent"`
+	Step  int     `json:"step"`
+	Model string  `json:"model"`
+	Usage Usage   `json:"usage"`
+	Cost  float64 `json:"cost_usd"`
+}
+
+// ToolRecord is a single tool invocation
+type ToolRecord struct {
+	Agent    string        `json:"agent"`
+	Tool     string        `json:"tool"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// UsageTracker collects token usage and tool calls for a run
+type UsageTracker struct {
+	mu      sync.Mutex
+	prices  PriceTable
+	records []UsageRecord
+	tools   []ToolRecord
+}
+
+// NewUsageTracker creates a tracker that prices usage with the given table
+func NewUsageTracker(prices PriceTable) *UsageTracker {
+	return &UsageTracker{prices: prices}
+}
+
+// Fork creates an empty tracker that prices usage with the same table
+func (t *UsageTracker) Fork() *UsageTracker {
+	return NewUsageTracker(t.prices)
+}
+
+// NewUsageTrackerFromEnv creates a tracker using the price table from PRICE_TABLE, if set
+func NewUsageTrackerFromEnv() (*UsageTracker, error) {
+	path := os.Getenv("PRICE_TABLE")
+	if path == "" {
+		return NewUsageTracker(DefaultPriceTable()), nil
+	}
+
+	prices, err := LoadPriceTable(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewUsageTracker(prices), nil
+}
+
+// Record adds the usage of a model call made by agent at the given step
+func (t *UsageTracker) Record(agent string, step int, model string, usage Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.records = append(t.records, UsageRecord{
+		Agent: agent,
+		Step:  step,
+		Model: model,
+		Usage: usage,
+		Cost:  t.prices.Cost(model, usage),
+	})
+}
+
+// RecordCompletion adds the usage reported in an openai-go chat completion
+func (t *UsageTracker) RecordCompletion(agent string, step int, completion openai.ChatCompletion) {
+	t.Record(agent, step, completion.Model, Usage{
+		PromptTokens:     completion.Usage.PromptTokens,
+		CompletionTokens: completion.Usage.CompletionTokens,
+		CachedTokens:     completion.Usage.PromptTokensDetails.CachedTokens,
+	})
+}
+
+// RecordTool adds a tool invocation made by agent
+func (t *UsageTracker) RecordTool(agent, tool string, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tools = append(t.tools, ToolRecord{Agent: agent, Tool: tool, Duration: duration})
+}
+
+// UsageSummary aggregates usage records
+type UsageSummary struct {
+	Calls int     `json:"calls"`
+	Usage Usage   `json:"usage"`
+	Cost  float64 `json:"cost_usd"`
+}
+
+// ToolSummary aggregates tool invocations
+type ToolSummary struct {
+	Calls    int           `json:"calls"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// UsageReport is the JSON report written at the end of a run
+type UsageReport struct {
+	Total   UsageSummary            `json:"total"`
+	ByAgent map[string]UsageSummary `json:"by_agent"`
+	ByStep  map[int]UsageSummary    `json:"by_step"`
+	ByTool  map[string]ToolSummary  `json:"by_tool"`
+	Records []UsageRecord           `json:"records"`
+}
+
+// Report aggregates everything recorded so far
+func (t *UsageTracker) Report() UsageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := UsageReport{
+		ByAgent: make(map[string]UsageSummary),
+		ByStep:  make(map[int]UsageSummary),
+		ByTool:  make(map[string]ToolSummary),
+		Records: append([]UsageRecord(nil), t.records...),
+	}
+
+	add := func(summary UsageSummary, record UsageRecord) UsageSummary {
+		return UsageSummary{
+			Calls: summary.Calls + 1,
+			Usage: summary.Usage.Add(record.Usage),
+			Cost:  summary.Cost + record.Cost,
+		}
+	}
+
+	for _, record := range t.records {
+		report.Total = add(report.Total, record)
+		report.ByAgent[record.Agent] = add(report.ByAgent[record.Agent], record)
+		report.ByStep[record.Step] = add(report.ByStep[record.Step], record)
+	}
+
+	for _, tool := range t.tools {
+		summary := report.ByTool[tool.Tool]
+		summary.Calls++
+		summary.Duration += tool.Duration
+		report.ByTool[tool.Tool] = summary
+	}
+
+	return report
+}
+
+// PrintSummary prints a cost summary per agent and per tool
+func (t *UsageTracker) PrintSummary(w io.Writer) {
+	report := t.Report()
+
+	fmt.Fprintf(w, "\n\033[96mUsage Summary\033[0m\n")
+	fmt.Fprintf(w, "%-12s %6s %10s %10s %10s %10s\n", "Agent", "Calls", "Prompt", "Cached", "Completion", "Cost")
+
+	agents := make([]string, 0, len(report.ByAgent))
+	for agent := range report.ByAgent {
+		agents = append(agents, agent)
+	}
+	sort.Strings(agents)
+
+	printRow := func(name string, summary UsageSummary) {
+		fmt.Fprintf(w, "%-12s %6d %10d %10d %10d %9.4f$\n",
+			name,
+			summary.Calls,
+			summary.Usage.PromptTokens,
+			summary.Usage.CachedTokens,
+			summary.Usage.CompletionTokens,
+			summary.Cost,
+		)
+	}
+
+	for _, agent := range agents {
+		printRow(agent, report.ByAgent[agent])
+	}
+	printRow("total", report.Total)
+
+	if len(report.ByTool) == 0 {
+		return
+	}
+
+	tools := make([]string, 0, len(report.ByTool))
+	for tool := range report.ByTool {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+
+	fmt.Fprintf(w, "\n%-12s %6s %12s\n", "Tool", "Calls", "Duration")
+	for _, tool := range tools {
+		summary := report.ByTool[tool]
+		fmt.Fprintf(w, "%-12s %6d %12v\n", tool, summary.Calls, summary.Duration.Round(time.Millisecond))
+	}
+}
+
+// WriteReport writes the JSON usage report to path
+func (t *UsageTracker) WriteReport(path string) error {
+	data, err := json.MarshalIndent(t.Report(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage report: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write usage report: %w", err)
+	}
+
+	return nil
+}
+
+// UsageTransport is an http.RoundTripper that records usage from chat completion responses.
+// It's meant for clients that don't expose the raw response, like langchaingo and swarmgo.
+// Completions are also traced as model spans of the request context, or of the span context
+// for clients that don't pass a context to their requests.
+type UsageTransport struct {
+	base      http.RoundTripper
+	tracker   *UsageTracker
+	attribute func() (agent string, step int)
+
+	mu          sync.Mutex
+	spanContext context.Context
+}
+
+// NewUsageTransport wraps base and attributes every recorded call using attribute
+func NewUsageTransport(base http.RoundTripper, tracker *UsageTracker, attribute func() (string, int)) *UsageTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &UsageTransport{
+		base:      base,
+		tracker:   tracker,
+		attribute: attribute,
+	}
+}
+
+// SetSpanContext sets the context model spans are started from when the request context has no tracer
+func (t *UsageTransport) SetSpanContext(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spanContext = ctx
+}
+
+// startSpan starts a model span for the request
+func (t *UsageTransport) startSpan(req *http.Request) *Span {
+	ctx := req.Context()
+	if !TracingEnabled(ctx) {
+		t.mu.Lock()
+		if t.spanContext != nil {
+			ctx = t.spanContext
+		}
+		t.mu.Unlock()
+	}
+
+	_, span := StartSpan(ctx, SpanModel, "chat.completions")
+	if TracingEnabled(ctx) && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			span.Input = string(data)
+		}
+	}
+
+	return span
+}
+
+// RoundTrip executes the request and records the usage of non-streamed completions
+func (t *UsageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/chat/completions") {
+		return t.base.RoundTrip(req)
+	}
+
+	span := t.startSpan(req)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.Finish(err)
+		return resp, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		span.Finish(fmt.Errorf("unexpected status %s", resp.Status))
+		return resp, nil
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		span.Finish(nil)
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		span.Finish(err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var completion struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens        int64 `json:"prompt_tokens"`
+			CompletionTokens    int64 `json:"completion_tokens"`
+			PromptTokensDetails struct {
+				CachedTokens int64 `json:"cached_tokens"`
+			} `json:"prompt_tokens_details"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		// Not a completion we understand, pass it through untouched
+		span.Finish(nil)
+		return resp, nil
+	}
+
+	agent, step := t.attribute()
+	t.tracker.Record(agent, step, completion.Model, Usage{
+		PromptTokens:     completion.Usage.PromptTokens,
+		CompletionTokens: completion.Usage.CompletionTokens,
+		CachedTokens:     completion.Usage.PromptTokensDetails.CachedTokens,
+	})
+
+	span.Name = completion.Model
+	if len(completion.Choices) > 0 {
+		span.Output = completion.Choices[0].Message.Content
+	}
+	span.SetAttribute("agent", agent)
+	span.SetAttribute("step", step)
+	span.SetAttribute("prompt_tokens", completion.Usage.PromptTokens)
+	span.SetAttribute("completion_tokens", completion.Usage.CompletionTokens)
+	span.Finish(nil)
+
+	return resp, nil
+}
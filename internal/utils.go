@@ -1,25 +1,45 @@
 package internal
 
 import (
-	"log"
 	"os"
+	"sync"
 
 	"github.com/joho/godotenv"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 )
 
+// defaultEnvFile is loaded when ENV_FILE isn't set
+const defaultEnvFile = "/Users/nszavadin/tmpSecrets/.env"
+
+var loadEnvOnce sync.Once
+
+// LoadEnv loads the .env file at ENV_FILE or the default path once. The variables
+// may as well come from the environment, so a missing file is logged, not fatal.
 func LoadEnv() {
-	err := godotenv.Load("/Users/nszavadin/tmpSecrets/.env")
-	if err != nil {
-		log.Fatal(err)
-	}
+	loadEnvOnce.Do(func() {
+		path := os.Getenv("ENV_FILE")
+		explicit := path != ""
+		if !explicit {
+			path = defaultEnvFile
+		}
+
+		if err := godotenv.Load(path); err != nil {
+			logger := Logger("env")
+			if explicit {
+				logger.Warn("failed to load env file", "path", path, "error", err)
+			} else {
+				logger.Debug("no env file, using the environment", "path", path, "error", err)
+			}
+		}
+	})
 }
 
-func NewOpenAIClient() openai.Client {
+// NewOpenAIClient creates a client with the OPENAI_API_KEY and any further options
+func NewOpenAIClient(options ...option.RequestOption) openai.Client {
 	LoadEnv()
 
 	return openai.NewClient(
-		option.WithAPIKey(os.Getenv("OPENAI_API_KEY")),
+		append([]option.RequestOption{option.WithAPIKey(os.Getenv("OPENAI_API_KEY"))}, options...)...,
 	)
 }
@@ -0,0 +1,486 @@
+// Package llmchain implements the ReAct agent with the langchaingo framework
+package llmchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	"github.com/tmc/langchaingo/agents"
+	"github.com/tmc/langchaingo/callbacks"
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+	"github.com/tmc/langchaingo/memory"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/tools"
+)
+
+// defaultModel is the chain's model without --model
+const defaultModel = "gpt-4.1"
+
+// defaultQueries are the example queries used when none are given
+var defaultQueries = []string{
+	"What's the response time for wolt.com?",
+	"What version of Golang is installed on this machine?",
+	"What is the weather in Helsinki today (in Celsius)? Peferably from accuweather ",
+}
+
+// promptSuffix is langchaingo's default MRKL suffix with the conversation history added
+const promptSuffix = `Previous conversation:
+{{.history}}
+
+Begin!
+
+Question: {{.input}}
+{{.agent_scratchpad}}`
+
+// Custom tool implementations
+type PingTool struct{}
+
+func (p PingTool) Name() string {
+	return "ping"
+}
+
+func (p PingTool) Description() string {
+	return "Ping a website and get the response time"
+}
+
+func (p PingTool) Call(ctx context.Context, input string) (string, error) {
+	if !strings.HasPrefix(input, "https://") && !strings.HasPrefix(input, "http://") {
+		input = "https://" + input
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, input, nil)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	duration := time.Since(start).Seconds()
+	return fmt.Sprintf("%.2f seconds", duration), nil
+}
+
+type BashTool struct{}
+
+func (b BashTool) Name() string {
+	return "bash"
+}
+
+func (b BashTool) Description() string {
+	return "Execute a bash command and return the output"
+}
+
+func (b BashTool) Call(ctx context.Context, command string) (string, error) {
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+type WebSearchTool struct{}
+
+func (w WebSearchTool) Name() string {
+	return "web_search"
+}
+
+func (w WebSearchTool) Description() string {
+	return "Search the web and return the json with the urls of search results"
+}
+
+func (w WebSearchTool) Call(ctx context.Context, query string) (string, error) {
+	query = strings.ReplaceAll(query, `"`, "")
+	// Create search client for finding URLs
+	searchClient := internal.NewSearchClient()
+
+	results, err := searchClient.Search(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to search the web: %w", err)
+	}
+
+	if len(results) == 0 {
+		return "No results found", nil
+	}
+
+	jsonResults, err := json.Marshal(results)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal results: %w", err)
+	}
+
+	return string(jsonResults), nil
+}
+
+type ScrapeTool struct{}
+
+func (s ScrapeTool) Name() string {
+	return "scrape"
+}
+
+func (s ScrapeTool) Description() string {
+	return "Fetch the content of a URL"
+}
+
+func (s ScrapeTool) Call(ctx context.Context, url string) (string, error) {
+	url = strings.ReplaceAll(url, `"`, "")
+	scraperClient := internal.NewScraperClient()
+	content, err := scraperClient.Scrape(url)
+	if err != nil {
+		return "", err
+	}
+
+	return content, nil
+}
+
+type KnowledgeSearchTool struct {
+	kb *internal.KnowledgeBase
+}
+
+func (k KnowledgeSearchTool) Name() string {
+	return "knowledge_search"
+}
+
+func (k KnowledgeSearchTool) Description() string {
+	return "Search our own documents and return the most relevant passages"
+}
+
+func (k KnowledgeSearchTool) Call(ctx context.Context, query string) (string, error) {
+	query = strings.ReplaceAll(query, `"`, "")
+	hits, err := k.kb.Search(ctx, query, 3)
+	if err != nil {
+		return "", err
+	}
+
+	return internal.FormatHits(hits), nil
+}
+
+// TrackedTool records every call of the wrapped tool in the usage tracker and as a tool span.
+// langchaingo's executor aborts on any tool error, so recoverable errors are returned
+// as the observation instead and only fatal ones abort the run.
+type TrackedTool struct {
+	tools.Tool
+	tracker *internal.UsageTracker
+}
+
+func (t TrackedTool) Call(ctx context.Context, input string) (string, error) {
+	ctx, span := internal.StartSpan(ctx, internal.SpanTool, t.Name())
+	span.Input = input
+
+	output, err := t.Tool.Call(ctx, input)
+	t.tracker.RecordTool("langchain", t.Name(), time.Since(span.Start))
+	span.Output = output
+
+	if err != nil {
+		toolErr := internal.NewToolError(t.Name(), err)
+		span.Finish(toolErr)
+		if toolErr.Fatal {
+			return "", toolErr
+		}
+		return toolErr.Observation(), nil
+	}
+
+	span.Finish(nil)
+	return output, nil
+}
+
+// temperatureModel sets the temperature on every call, langchaingo's executor has no option for it
+type temperatureModel struct {
+	llms.Model
+	temperature float64
+}
+
+func (m temperatureModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	return m.Model.GenerateContent(ctx, messages, append(options, llms.WithTemperature(m.temperature))...)
+}
+
+// chain builds a langchaingo executor and runs queries through it
+type chain struct {
+	httpClient  *http.Client
+	tools       []tools.Tool
+	memory      schema.Memory
+	session     *internal.Session
+	tracker     *internal.UsageTracker
+	model       string
+	temperature *float64
+	maxIter     int
+	// calls counts the model calls of the current query
+	calls int
+	// trace logs every step of the executor
+	trace bool
+}
+
+// newChain creates a chain whose model calls and tool calls are recorded in tracker
+func newChain(tracker *internal.UsageTracker, kb *internal.KnowledgeBase, session *internal.Session, options internal.RunOptions) *chain {
+	// Set up tools
+	var agentTools []tools.Tool
+	for _, tool := range []tools.Tool{
+		PingTool{},
+		BashTool{},
+		WebSearchTool{},
+		ScrapeTool{},
+		KnowledgeSearchTool{kb},
+	} {
+		if options.ToolEnabled(tool.Name()) {
+			agentTools = append(agentTools, TrackedTool{tool, tracker})
+		}
+	}
+
+	conversation := memory.NewConversationBuffer(
+		memory.WithChatHistory(session),
+		memory.WithInputKey("input"),
+		memory.WithOutputKey("output"),
+	)
+
+	c := &chain{
+		tools:       agentTools,
+		memory:      conversation,
+		session:     session,
+		tracker:     tracker,
+		model:       options.ModelOr(defaultModel),
+		temperature: options.Temperature,
+		maxIter:     options.MaxIter,
+	}
+
+	// langchaingo doesn't expose cached tokens, so usage is read from the raw responses
+	c.httpClient = &http.Client{
+		Transport: internal.NewUsageTransport(http.DefaultTransport, tracker, func() (string, int) {
+			c.calls++
+			return "langchain", c.calls
+		}),
+	}
+
+	return c
+}
+
+// newExecutor creates an executor for the current model and settings
+func (c *chain) newExecutor() (*agents.Executor, error) {
+	var llm llms.Model
+	llm, err := openai.New(
+		openai.WithToken(os.Getenv("OPENAI_API_KEY")),
+		openai.WithModel(c.model),
+		openai.WithHTTPClient(c.httpClient),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing OpenAI client: %w", err)
+	}
+	if c.temperature != nil {
+		llm = temperatureModel{Model: llm, temperature: *c.temperature}
+	}
+
+	options := []agents.Option{
+		agents.WithMaxIterations(c.maxIter),
+		agents.WithPromptSuffix(promptSuffix),
+		agents.WithMemory(c.memory),
+	}
+	if c.trace {
+		options = append(options, agents.WithCallbacksHandler(callbacks.LogHandler{}))
+	}
+
+	agent := agents.NewOneShotAgent(llm, c.tools, options...)
+	return agents.NewExecutor(agent, options...), nil
+}
+
+// run answers a single query
+func (c *chain) run(ctx context.Context, query string) (answer string, err error) {
+	ctx, span := internal.StartSpan(ctx, internal.SpanRun, "langchain")
+	span.Input = query
+	span.SetAttribute("model", c.model)
+	defer func() {
+		span.Output = answer
+		span.Finish(err)
+	}()
+
+	c.calls = 0
+	executor, err := c.newExecutor()
+	if err != nil {
+		return "", err
+	}
+
+	return chains.Run(ctx, executor, query)
+}
+
+// runREPL runs the chain interactively until the user quits
+func runREPL(ctx context.Context, c *chain) error {
+	repl := internal.NewREPL("langchain> ", func(ctx context.Context, input string) error {
+		result, err := c.run(ctx, input)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Result:", result)
+		return nil
+	})
+
+	repl.AddCommand(internal.Command{
+		Name:        "reset",
+		Usage:       "/reset",
+		Description: "Start a new session",
+		Run: func(ctx context.Context, args []string) error {
+			c.session.Reset()
+			fmt.Printf("Session: %s\n", c.session.ID)
+			return nil
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "tools",
+		Usage:       "/tools",
+		Description: "List available tools",
+		Run: func(ctx context.Context, args []string) error {
+			for _, tool := range c.tools {
+				fmt.Printf("%s: %s\n", tool.Name(), tool.Description())
+			}
+			return nil
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "model",
+		Usage:       "/model [name]",
+		Description: "Show or change the model",
+		Run: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				c.model = args[0]
+			}
+			fmt.Printf("Model: %s\n", c.model)
+			return nil
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "cost",
+		Usage:       "/cost",
+		Description: "Show token usage and cost so far",
+		Run: func(ctx context.Context, args []string) error {
+			c.tracker.PrintSummary(os.Stdout)
+			return nil
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "save",
+		Usage:       "/save <file>",
+		Description: "Save the session to a file",
+		Run: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("usage: /save <file>")
+			}
+			return c.session.Export(ctx, args[0])
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "load",
+		Usage:       "/load <file>",
+		Description: "Continue a session saved with /save",
+		Run: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("usage: /load <file>")
+			}
+			if err := c.session.Import(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Session: %s\n", c.session.ID)
+			return nil
+		},
+	})
+	repl.AddCommand(internal.Command{
+		Name:        "trace",
+		Usage:       "/trace",
+		Description: "Toggle logging of every executor step",
+		Run: func(ctx context.Context, args []string) error {
+			c.trace = !c.trace
+			fmt.Printf("Trace: %v\n", c.trace)
+			return nil
+		},
+	})
+
+	return repl.Run(ctx)
+}
+
+// Run answers the queries with a langchaingo executor, or starts a REPL in interactive mode
+func Run(ctx context.Context, options internal.RunOptions) error {
+	internal.LoadEnv()
+
+	tracker, err := internal.NewUsageTrackerFromEnv()
+	if err != nil {
+		return fmt.Errorf("error loading price table: %w", err)
+	}
+
+	kb, err := internal.OpenKnowledgeBaseFromEnv(ctx, tracker)
+	if err != nil {
+		return fmt.Errorf("error opening knowledge base: %w", err)
+	}
+
+	// The session backs langchaingo memory, so follow-up questions see earlier answers
+	store, err := internal.NewSessionStoreFromEnv()
+	if err != nil {
+		return fmt.Errorf("error opening session store: %w", err)
+	}
+	session := internal.NewSessionFromEnv(store, internal.NewTokenizer(options.ModelOr(defaultModel)), internal.NewOpenAISummarizer(internal.NewOpenAIClient(), "gpt-4o-mini", tracker))
+	internal.Logger("agent").Info("session started, set SESSION_ID to resume it", "session", session.ID)
+
+	c := newChain(tracker, kb, session, options)
+
+	if options.Interactive {
+		if err := runREPL(ctx, c); err != nil {
+			return err
+		}
+	} else {
+		for i, query := range options.QueriesOr(defaultQueries...) {
+			internal.Logger("agent").Info("running query", "index", i+1, "query", query)
+
+			result := internal.RunResult{Query: query}
+			answer, err := c.run(ctx, query)
+			if err != nil {
+				result.Error = err.Error()
+			}
+			result.Answer = answer
+
+			internal.PrintResult(os.Stdout, options.Output, result)
+		}
+	}
+
+	tracker.PrintSummary(options.Console())
+	if err := tracker.WriteReport("usage_report.json"); err != nil {
+		return fmt.Errorf("error writing usage report: %w", err)
+	}
+
+	return nil
+}
+
+// NewAnswerer returns an answerer running every query in a fresh chain without session history
+func NewAnswerer(ctx context.Context, options internal.RunOptions) (internal.Answerer, error) {
+	internal.LoadEnv()
+
+	tracker, err := internal.NewUsageTrackerFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("error loading price table: %w", err)
+	}
+
+	kb, err := internal.OpenKnowledgeBaseFromEnv(ctx, tracker)
+	if err != nil {
+		return nil, fmt.Errorf("error opening knowledge base: %w", err)
+	}
+
+	return func(ctx context.Context, query string) (internal.Answer, error) {
+		queryTracker := tracker.Fork()
+		session := internal.NewSession(internal.NewSessionID(), internal.NewMemorySessionStore(), internal.BufferStrategy{})
+
+		text, err := newChain(queryTracker, kb, session, options).run(ctx, query)
+		report := queryTracker.Report()
+
+		return internal.Answer{
+			Text:  text,
+			Steps: report.ByAgent["langchain"].Calls,
+			Usage: report.Total,
+		}, err
+	}, nil
+}
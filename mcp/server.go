@@ -1,4 +1,5 @@
-package main
+// Package mcpserver exposes package documentation to IDEs over the Model Context Protocol
+package mcpserver
 
 import (
     "context"
@@ -9,7 +10,8 @@ import (
     "github.com/mark3labs/mcp-go/server"
 )
 
-func main() {
+// Serve runs the MCP server over stdio until the client disconnects
+func Serve() error {
     s := server.NewMCPServer(
         "Package Documentation Provider",
         "1.0.0",
@@ -28,8 +30,10 @@ func main() {
     s.AddTool(tool, packageDocumentationHandler)
 
     if err := server.ServeStdio(s); err != nil {
-        fmt.Printf("Server error: %v\n", err)
+        return fmt.Errorf("server error: %w", err)
     }
+
+    return nil
 }
 
 func packageDocumentationHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -0,0 +1,424 @@
+package multiagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	swarmgo "github.com/prathyushnallamothu/swarmgo"
+)
+
+// Limits of the blackboard shown in every agent's prompt, readBlackboard returns all of it
+const (
+	briefFacts       = 20
+	briefSources     = 15
+	briefSectionText = 150
+)
+
+// blackboardState is what the agents of a run know together, checkpointed with the run
+type blackboardState struct {
+	Facts     []blackboardFact     `json:"facts,omitempty"`
+	Sources   []blackboardSource   `json:"sources,omitempty"`
+	Sections  []blackboardSection  `json:"sections,omitempty"`
+	Questions []blackboardQuestion `json:"questions,omitempty"`
+	Reviews   []blackboardReview   `json:"reviews,omitempty"`
+}
+
+// blackboardFact is a finding, with the URL it came from if any
+type blackboardFact struct {
+	ID     string `json:"id"`
+	Text   string `json:"text"`
+	Source string `json:"source,omitempty"`
+}
+
+// blackboardSource is a page the agents used, with the provenance of scraped ones
+type blackboardSource struct {
+	ID      string    `json:"id"`
+	URL     string    `json:"url"`
+	Title   string    `json:"title,omitempty"`
+	Page    string    `json:"page,omitempty"`
+	Fetched time.Time `json:"fetched,omitempty"`
+	// Hash is the SHA-256 of the scraped content
+	Hash string `json:"hash,omitempty"`
+}
+
+// blackboardSection is a draft section of the report, replaced when written again
+type blackboardSection struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// blackboardQuestion is open until it has an answer
+type blackboardQuestion struct {
+	ID     string `json:"id"`
+	Text   string `json:"text"`
+	Answer string `json:"answer,omitempty"`
+}
+
+// blackboardReview is the critic's review of a draft, see submitReview
+type blackboardReview struct {
+	Round   int    `json:"round"`
+	Verdict string `json:"verdict"`
+	Summary string `json:"summary,omitempty"`
+	// Revisions is how many of the workflow's MaxRevisions the reviews have requested so far
+	Revisions    int           `json:"revisions"`
+	MaxRevisions int           `json:"max_revisions"`
+	Issues       []reviewIssue `json:"issues,omitempty"`
+}
+
+// reviewIssue is a claim of the draft the critic found unsupported or contradicted by the sources
+type reviewIssue struct {
+	Claim   string `json:"claim"`
+	Problem string `json:"problem"`
+	Source  string `json:"source,omitempty"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// blackboard is the state shared by all agents of a workflow. Tools read and write it, every
+// agent sees it in its prompt and every change is traced as a state span.
+type blackboard struct {
+	mu    sync.Mutex
+	state blackboardState
+}
+
+// reset starts the blackboard of a query, empty or from a checkpoint
+func (b *blackboard) reset(state *blackboardState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = blackboardState{}
+	if state != nil {
+		b.state = *state
+	}
+}
+
+// snapshot returns a copy of the state, or nil while it's empty
+func (b *blackboard) snapshot() *blackboardState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.state.Facts)+len(b.state.Sources)+len(b.state.Sections)+len(b.state.Questions)+len(b.state.Reviews) == 0 {
+		return nil
+	}
+
+	// Items are copied on write, so copying the slices is enough
+	return &blackboardState{
+		Facts:     append([]blackboardFact(nil), b.state.Facts...),
+		Sources:   append([]blackboardSource(nil), b.state.Sources...),
+		Sections:  append([]blackboardSection(nil), b.state.Sections...),
+		Questions: append([]blackboardQuestion(nil), b.state.Questions...),
+		Reviews:   append([]blackboardReview(nil), b.state.Reviews...),
+	}
+}
+
+// addFact adds a fact and its source, returning the fact's id
+func (b *blackboard) addFact(text, url string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if url != "" {
+		b.addSourceLocked(blackboardSource{URL: url})
+	}
+	id := fmt.Sprintf("f%d", len(b.state.Facts)+1)
+	b.state.Facts = append(b.state.Facts, blackboardFact{ID: id, Text: text, Source: url})
+	return id
+}
+
+// addSource adds a source, or fills in what's missing of the source with the same URL, returning its id
+func (b *blackboard) addSource(source blackboardSource) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.addSourceLocked(source)
+}
+
+func (b *blackboard) addSourceLocked(source blackboardSource) string {
+	for i, known := range b.state.Sources {
+		if known.URL != source.URL {
+			continue
+		}
+
+		updated := known
+		if updated.Title == "" {
+			updated.Title = source.Title
+		}
+		if updated.Page == "" {
+			updated.Page = source.Page
+		}
+		if updated.Hash == "" {
+			updated.Fetched, updated.Hash = source.Fetched, source.Hash
+		}
+		if updated != known {
+			b.state.Sources = append([]blackboardSource(nil), b.state.Sources...)
+			b.state.Sources[i] = updated
+		}
+		return known.ID
+	}
+
+	source.ID = fmt.Sprintf("s%d", len(b.state.Sources)+1)
+	b.state.Sources = append(b.state.Sources, source)
+	return source.ID
+}
+
+// sources returns the sources by id
+func (b *blackboard) sources() map[string]blackboardSource {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sources := make(map[string]blackboardSource, len(b.state.Sources))
+	for _, source := range b.state.Sources {
+		sources[source.ID] = source
+	}
+	return sources
+}
+
+// writeSection replaces the draft section with the same title where it is, or adds a new one at the end
+func (b *blackboard) writeSection(title, text string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sections := append(make([]blackboardSection, 0, len(b.state.Sections)+1), b.state.Sections...)
+	for i, section := range sections {
+		if strings.EqualFold(section.Title, title) {
+			sections[i] = blackboardSection{Title: title, Text: text}
+			b.state.Sections = sections
+			return
+		}
+	}
+	b.state.Sections = append(sections, blackboardSection{Title: title, Text: text})
+}
+
+// addQuestion adds an open question, returning its id
+func (b *blackboard) addQuestion(text string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := fmt.Sprintf("q%d", len(b.state.Questions)+1)
+	b.state.Questions = append(b.state.Questions, blackboardQuestion{ID: id, Text: text})
+	return id
+}
+
+// answer closes a question
+func (b *blackboard) answer(id, answer string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, question := range b.state.Questions {
+		if question.ID == id {
+			b.state.Questions = append([]blackboardQuestion(nil), b.state.Questions...)
+			b.state.Questions[i].Answer = answer
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown question %s", id)
+}
+
+// addReview adds a review with the verdict, counting revisions up to maxRevisions. A revision requested
+// when there are none left is recorded as unresolved. It returns the review as added.
+func (b *blackboard) addReview(review blackboardReview, maxRevisions int) blackboardReview {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	review.Round = len(b.state.Reviews) + 1
+	review.MaxRevisions = maxRevisions
+	if n := len(b.state.Reviews); n > 0 {
+		review.Revisions = b.state.Reviews[n-1].Revisions
+	}
+	if review.Verdict == verdictRevise {
+		if review.Revisions < maxRevisions {
+			review.Revisions++
+		} else {
+			review.Verdict = verdictUnresolved
+		}
+	}
+
+	b.state.Reviews = append(b.state.Reviews, review)
+	return review
+}
+
+// draftClosed returns an error once a review left the draft unresolved, as no revision rounds are left
+func (b *blackboard) draftClosed() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, review := range b.state.Reviews {
+		if review.Verdict == verdictUnresolved {
+			return fmt.Errorf("review %d left the draft unresolved after %d revision rounds, it can't be revised anymore", review.Round, review.MaxRevisions)
+		}
+	}
+	return nil
+}
+
+// brief renders the blackboard compactly for the agents' prompts, an empty one as nothing
+func (b *blackboard) brief() string {
+	state := b.snapshot()
+	if state == nil {
+		return ""
+	}
+	return "\n\nBlackboard shared by all agents:\n" + state.render(true)
+}
+
+// render lists the state, in compact form only the latest facts and sources, the beginning of
+// every section and the open questions
+func (s *blackboardState) render(compact bool) string {
+	var out strings.Builder
+
+	facts, sources := s.Facts, s.Sources
+	if compact {
+		facts, sources = latest(facts, briefFacts), latest(sources, briefSources)
+	}
+
+	if len(facts) > 0 {
+		fmt.Fprintf(&out, "Facts (%d):\n", len(s.Facts))
+		for _, fact := range facts {
+			fmt.Fprintf(&out, "- [%s] %s", fact.ID, fact.Text)
+			if fact.Source != "" {
+				fmt.Fprintf(&out, " (%s)", fact.Source)
+			}
+			out.WriteString("\n")
+		}
+	}
+	if len(sources) > 0 {
+		fmt.Fprintf(&out, "Sources (%d):\n", len(s.Sources))
+		for _, source := range sources {
+			fmt.Fprintf(&out, "- [%s] %s", source.ID, source.URL)
+			if source.Title != "" {
+				fmt.Fprintf(&out, " %s", source.Title)
+			}
+			if source.Page != "" {
+				fmt.Fprintf(&out, " (page %s)", source.Page)
+			}
+			out.WriteString("\n")
+		}
+	}
+	if len(s.Sections) > 0 {
+		out.WriteString("Draft sections:\n")
+		for _, section := range s.Sections {
+			text := section.Text
+			if compact {
+				text = fmt.Sprintf("%s (%d chars)", truncateText(strings.Join(strings.Fields(text), " "), briefSectionText), len(section.Text))
+			}
+			fmt.Fprintf(&out, "- %s: %s\n", section.Title, text)
+		}
+	}
+
+	var questions strings.Builder
+	for _, question := range s.Questions {
+		switch {
+		case question.Answer == "":
+			fmt.Fprintf(&questions, "- [%s] %s\n", question.ID, question.Text)
+		case !compact:
+			fmt.Fprintf(&questions, "- [%s] %s Answer: %s\n", question.ID, question.Text, question.Answer)
+		}
+	}
+	if questions.Len() > 0 {
+		out.WriteString("Questions:\n" + questions.String())
+	}
+
+	reviews := s.Reviews
+	if compact {
+		reviews = latest(reviews, 1)
+	}
+	for _, review := range reviews {
+		out.WriteString(review.render() + "\n")
+	}
+
+	return strings.TrimSpace(out.String())
+}
+
+// latest returns the last n items
+func latest[T any](items []T, n int) []T {
+	if len(items) > n {
+		return items[len(items)-n:]
+	}
+	return items
+}
+
+// truncateText cuts text to n characters
+func truncateText(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "..."
+}
+
+// trace records the blackboard after a change as a state span of ctx
+func (b *blackboard) trace(ctx context.Context, change string) {
+	now := time.Now()
+	_, span := internal.StartSpanAt(ctx, internal.SpanState, "blackboard", now)
+	span.Input = change
+	if state := b.snapshot(); state != nil {
+		data, _ := json.Marshal(state)
+		span.Output = string(data)
+	}
+	span.FinishAt(now, nil)
+}
+
+// Tool to add to the blackboard
+func (t *researchTools) writeBlackboard(ctx context.Context, args map[string]interface{}) swarmgo.Result {
+	kind, _ := args["kind"].(string)
+	text, _ := args["text"].(string)
+	url, _ := args["url"].(string)
+	title, _ := args["title"].(string)
+	id, _ := args["id"].(string)
+	text, url, title = strings.TrimSpace(text), strings.TrimSpace(url), strings.TrimSpace(title)
+
+	var done string
+	switch {
+	case kind == "fact" && text != "":
+		done = "Added fact " + t.board.addFact(text, url)
+	case kind == "source" && url != "":
+		done = "Added source " + t.board.addSource(blackboardSource{URL: url, Title: title})
+	case kind == "section" && title != "" && text != "":
+		if err := t.board.draftClosed(); err != nil {
+			return swarmgo.Result{
+				Data:    fmt.Sprintf("Error: %v", err),
+				Success: false,
+			}
+		}
+		t.board.writeSection(title, text)
+		done = "Wrote section " + title
+	case kind == "question" && text != "":
+		done = "Added question " + t.board.addQuestion(text)
+	case kind == "answer" && id != "" && text != "":
+		if err := t.board.answer(id, text); err != nil {
+			return swarmgo.Result{
+				Data:    fmt.Sprintf("Error: %v", err),
+				Success: false,
+			}
+		}
+		done = "Answered question " + id
+	default:
+		return swarmgo.Result{
+			Data:    "Error: expected a fact or question with text, a source with url, a section with title and text, or an answer with the question id and text",
+			Success: false,
+		}
+	}
+
+	t.board.trace(ctx, done)
+	return swarmgo.Result{
+		Data:    done,
+		Success: true,
+	}
+}
+
+// Tool to read the whole blackboard
+func (t *researchTools) readBlackboard(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+	state := t.board.snapshot()
+	if state == nil {
+		return swarmgo.Result{
+			Data:    "The blackboard is empty",
+			Success: true,
+		}
+	}
+
+	return swarmgo.Result{
+		Data:    state.render(false),
+		Success: true,
+	}
+}
@@ -0,0 +1,390 @@
+package multiagent
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+)
+
+// defaultCheckpointDir holds the checkpoints of workflow runs unless CHECKPOINT_DIR is set
+const defaultCheckpointDir = "checkpoints"
+
+// runRecord describes a checkpointed run, with everything needed to rebuild its workflow
+type runRecord struct {
+	ID         string              `json:"id"`
+	Query      string              `json:"query"`
+	Created    time.Time           `json:"created"`
+	Definition *workflowDefinition `json:"definition"`
+	Options    internal.RunOptions `json:"options"`
+	// Parent is the run this one was resumed from at ParentStep, if not at its last checkpoint
+	Parent     string `json:"parent,omitempty"`
+	ParentStep int    `json:"parent_step,omitempty"`
+}
+
+// workflowCheckpoint is the state of a run after a step, or while it waits for a human's answer
+type workflowCheckpoint struct {
+	Step  int        `json:"step"`
+	Time  time.Time  `json:"time"`
+	State graphState `json:"state"`
+	// Next are the agents continuing the run, none once it finished
+	Next []string `json:"next,omitempty"`
+	// Waiting holds the joins of the graph engine, see graph.Checkpoint
+	Waiting map[string][]string `json:"waiting,omitempty"`
+	// Delta marks a saved checkpoint whose state only holds what changed since the one before,
+	// see stateDelta. Checkpoints are read back whole.
+	Delta bool `json:"delta,omitempty"`
+}
+
+// finished reports whether the run was done at this checkpoint
+func (c workflowCheckpoint) finished() bool {
+	return len(c.Next) == 0 && c.State.Pending == ""
+}
+
+// stateDelta returns what changed from prev to next: the outputs and answers added, the variables
+// and blackboard if they changed and the rest of the state as it is. It reports false if the change
+// can't be expressed this way, e.g. outputs were removed.
+func stateDelta(prev, next graphState) (graphState, bool) {
+	if next.Query != prev.Query || !hasPrefix(next.Outputs, prev.Outputs) || !hasPrefix(next.Answers, prev.Answers) {
+		return graphState{}, false
+	}
+
+	delta := graphState{
+		Outputs: next.Outputs[len(prev.Outputs):],
+		Answers: next.Answers[len(prev.Answers):],
+		Next:    next.Next,
+		Pending: next.Pending,
+	}
+	if !reflect.DeepEqual(prev.Variables, next.Variables) {
+		if next.Variables == nil {
+			return graphState{}, false
+		}
+		delta.Variables = next.Variables
+	}
+	if !reflect.DeepEqual(prev.Blackboard, next.Blackboard) {
+		if next.Blackboard == nil {
+			return graphState{}, false
+		}
+		delta.Blackboard = next.Blackboard
+	}
+	return delta, true
+}
+
+// applyDelta returns the state after prev changed by delta, see stateDelta
+func applyDelta(prev, delta graphState) graphState {
+	next := prev
+	next.Outputs = append(slices.Clone(prev.Outputs), delta.Outputs...)
+	next.Answers = append(slices.Clone(prev.Answers), delta.Answers...)
+	next.Next, next.Pending = delta.Next, delta.Pending
+	if delta.Variables != nil {
+		next.Variables = delta.Variables
+	}
+	if delta.Blackboard != nil {
+		next.Blackboard = delta.Blackboard
+	}
+	return next
+}
+
+func hasPrefix[T comparable](items, prefix []T) bool {
+	return len(items) >= len(prefix) && slices.Equal(items[:len(prefix)], prefix)
+}
+
+// checkpointStore keeps every run in a directory of its own: the run.json record and checkpoints.jsonl.
+// The first checkpoint written by a process holds the whole state, the ones after it what changed,
+// so the file grows with the steps of the run rather than with their square.
+type checkpointStore struct {
+	dir string
+}
+
+// checkpointStoreFromEnv returns the store at CHECKPOINT_DIR, or nil if CHECKPOINTS=0
+func checkpointStoreFromEnv() *checkpointStore {
+	if os.Getenv("CHECKPOINTS") == "0" {
+		return nil
+	}
+
+	dir := os.Getenv("CHECKPOINT_DIR")
+	if dir == "" {
+		dir = defaultCheckpointDir
+	}
+	return &checkpointStore{dir: dir}
+}
+
+// create saves a new run and returns its checkpoints, or nil checkpoints without a store
+func (s *checkpointStore) create(record runRecord) (*runCheckpoints, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	id := make([]byte, 3)
+	rand.Read(id)
+	record.ID = time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(id)
+	record.Created = time.Now()
+
+	dir := filepath.Join(s.dir, record.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode run: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "run.json"), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write run: %w", err)
+	}
+
+	return s.append(record.ID)
+}
+
+// append opens the checkpoints of a run for appending, ending a line cut off by a crash
+func (s *checkpointStore) append(id string) (*runCheckpoints, error) {
+	file, err := internal.OpenLines(filepath.Join(s.dir, id, "checkpoints.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoints: %w", err)
+	}
+
+	internal.Logger("agent").Info("checkpointing run", "run", id, "dir", s.dir)
+	return &runCheckpoints{id: id, file: file}, nil
+}
+
+// valid reports an error unless id is one of the runs of the store, e.g. not a path leading out of it
+func (s *checkpointStore) valid(id string) error {
+	ids, err := s.list()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(ids, id) {
+		return fmt.Errorf("unknown run %q, see agents resume for the runs", id)
+	}
+	return nil
+}
+
+// open reads a run and its checkpoints, which must be one of the runs of the store
+func (s *checkpointStore) open(id string) (*runRecord, []workflowCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, id, "run.json"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read run %s: %w", id, err)
+	}
+
+	var record runRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse run %s: %w", id, err)
+	}
+
+	file, err := os.Open(filepath.Join(s.dir, id, "checkpoints.jsonl"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read checkpoints of run %s: %w", id, err)
+	}
+	defer file.Close()
+
+	var checkpoints []workflowCheckpoint
+	var state graphState
+	var broken bool
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var checkpoint workflowCheckpoint
+		if err := json.Unmarshal(scanner.Bytes(), &checkpoint); err != nil {
+			// A line may be cut off by a crash, every complete one before it is usable and
+			// the run resumed after it starts over with a whole state
+			internal.Logger("agent").Warn("skipping unreadable checkpoint", "run", id, "error", err)
+			broken = true
+			continue
+		}
+		if checkpoint.Delta {
+			if broken {
+				continue
+			}
+			checkpoint.State, checkpoint.Delta = applyDelta(state, checkpoint.State), false
+		}
+		broken = false
+		state = checkpoint.State
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read checkpoints of run %s: %w", id, err)
+	}
+
+	return &record, checkpoints, nil
+}
+
+// list returns the ids of all runs, the latest first
+func (s *checkpointStore) list() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+// fork creates a run continuing another one from an earlier checkpoint, keeping the checkpoints up to it
+func (s *checkpointStore) fork(record runRecord, checkpoints []workflowCheckpoint) (*runCheckpoints, error) {
+	last := checkpoints[len(checkpoints)-1]
+	record.Parent, record.ParentStep = record.ID, last.Step
+
+	run, err := s.create(record)
+	if err != nil {
+		return nil, err
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	for _, checkpoint := range checkpoints {
+		if err := run.write(checkpoint); err != nil {
+			run.close()
+			return nil, err
+		}
+	}
+	return run, nil
+}
+
+// runCheckpoints saves the checkpoints of a run. A nil runCheckpoints saves nothing.
+type runCheckpoints struct {
+	id   string
+	mu   sync.Mutex
+	file *os.File
+	// last is the latest checkpoint, the base of the ones taken while waiting for a human
+	last workflowCheckpoint
+	// written is the state of the last checkpoint written, the base of the next delta
+	written *graphState
+	// answers are the human's answers so far, the engines don't keep them in their state
+	answers []humanAnswer
+	// board is the blackboard of the run, saved with every checkpoint
+	board *blackboard
+}
+
+// track saves the blackboard with every checkpoint
+func (c *runCheckpoints) track(board *blackboard) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.board = board
+}
+
+// resumeFrom continues the run after a checkpoint
+func (c *runCheckpoints) resumeFrom(checkpoint workflowCheckpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last = checkpoint
+	c.answers = checkpoint.State.Answers
+}
+
+// save appends a checkpoint with the human's answers so far
+func (c *runCheckpoints) save(checkpoint workflowCheckpoint) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	checkpoint.State.Answers = c.answers
+	if c.board != nil {
+		checkpoint.State.Blackboard = c.board.snapshot()
+	}
+	return c.write(checkpoint)
+}
+
+// write appends a checkpoint as it is, the lock must be held
+func (c *runCheckpoints) write(checkpoint workflowCheckpoint) error {
+	if checkpoint.Time.IsZero() {
+		checkpoint.Time = time.Now()
+	}
+
+	line := checkpoint
+	if c.written != nil {
+		if delta, ok := stateDelta(*c.written, checkpoint.State); ok {
+			line.State, line.Delta = delta, true
+		}
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	if _, err := c.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := c.file.Sync(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	c.last = checkpoint
+	c.written = &checkpoint.State
+	return nil
+}
+
+// ask saves that the run is waiting for a human to answer a question
+func (c *runCheckpoints) ask(question string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	checkpoint := c.last
+	c.mu.Unlock()
+
+	checkpoint.Time = time.Time{}
+	checkpoint.State.Pending = question
+	if err := c.save(checkpoint); err != nil {
+		internal.Logger("agent").Error("failed to checkpoint question", "error", err)
+	}
+}
+
+// answered saves the human's answer to the pending question
+func (c *runCheckpoints) answered(question, answer string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	checkpoint := c.last
+	c.answers = append(slices.Clone(c.answers), humanAnswer{Question: question, Answer: answer})
+	c.mu.Unlock()
+
+	checkpoint.Time = time.Time{}
+	checkpoint.State.Pending = ""
+	if err := c.save(checkpoint); err != nil {
+		internal.Logger("agent").Error("failed to checkpoint answer", "error", err)
+	}
+}
+
+// saveLogged saves a checkpoint, logging failures, as a lost checkpoint shouldn't stop the run
+func (c *runCheckpoints) saveLogged(checkpoint workflowCheckpoint) {
+	if err := c.save(checkpoint); err != nil {
+		internal.Logger("agent").Error("failed to checkpoint run", "run", c.id, "step", checkpoint.Step, "error", err)
+	}
+}
+
+func (c *runCheckpoints) close() {
+	if c != nil {
+		c.file.Close()
+	}
+}
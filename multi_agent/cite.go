@@ -0,0 +1,230 @@
+package multiagent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	swarmgo "github.com/prathyushnallamothu/swarmgo"
+)
+
+// minCitedWords is the length from which a paragraph makes claims that need a citation
+const minCitedWords = 12
+
+// uncitedMark flags a paragraph without citations
+const uncitedMark = " [citation needed]"
+
+var (
+	// citationPattern matches citations of sources by id, e.g. [s1] or [s1, s3], also once marked as unknown
+	citationPattern = regexp.MustCompile(`\[(s\d+\??(?:\s*,\s*s\d+\??)*)\]`)
+	// referencesPattern matches the heading of a references section the writer wrote itself
+	referencesPattern = regexp.MustCompile(`(?i)^#{1,6}\s*(references|sources)$`)
+	// headingPattern matches a Markdown heading
+	headingPattern = regexp.MustCompile(`^#{1,6}(\s|$)`)
+	// listItemPattern matches the start of a Markdown list item
+	listItemPattern = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+`)
+)
+
+// citationCheck is what checking the citations of a report found
+type citationCheck struct {
+	// Cited are the ids of the cited sources in the order they were first cited
+	Cited []string
+	// Unknown are cited ids without a source
+	Unknown []string
+	// Uncited counts the paragraphs and list items flagged as uncited
+	Uncited int
+}
+
+// summary describes the problems found, or is empty if there are none
+func (c citationCheck) summary() string {
+	var problems []string
+	if len(c.Unknown) > 0 {
+		problems = append(problems, fmt.Sprintf("unknown sources %s are marked with ?", strings.Join(c.Unknown, ", ")))
+	}
+	if c.Uncited > 0 {
+		problems = append(problems, fmt.Sprintf("%d paragraphs without citations are marked%s", c.Uncited, uncitedMark))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// referencesStart returns where the report's references section starts if it's the final section,
+// or -1. Headings in code blocks don't count.
+func referencesStart(report string) int {
+	start, offset := -1, 0
+	fenced := false
+	for _, line := range strings.SplitAfter(report, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			fenced = !fenced
+		case fenced:
+		case referencesPattern.MatchString(trimmed):
+			start = offset
+		case headingPattern.MatchString(trimmed):
+			start = -1
+		}
+		offset += len(line)
+	}
+	return start
+}
+
+// citeReport checks the citations of a Markdown report against the sources: unknown ids are marked
+// with a ?, paragraphs and list items making claims without a citation are flagged, and a
+// references section listing the cited sources replaces any the writer wrote
+func citeReport(report string, sources map[string]blackboardSource) (string, citationCheck) {
+	// A report checked before is checked again from scratch
+	var check citationCheck
+	if start := referencesStart(report); start >= 0 {
+		report = report[:start]
+	}
+	report = strings.ReplaceAll(report, uncitedMark, "")
+
+	cited := make(map[string]bool)
+	unknown := make(map[string]bool)
+	cite := func(text string) (string, bool) {
+		found := false
+		text = citationPattern.ReplaceAllStringFunc(text, func(citation string) string {
+			found = true
+			ids := strings.Split(strings.Trim(citation, "[]"), ",")
+			for i, id := range ids {
+				id = strings.TrimSuffix(strings.TrimSpace(id), "?")
+				ids[i] = id
+				if _, ok := sources[id]; !ok {
+					if !unknown[id] {
+						unknown[id] = true
+						check.Unknown = append(check.Unknown, id)
+					}
+					ids[i] = id + "?"
+				} else if !cited[id] {
+					cited[id] = true
+					check.Cited = append(check.Cited, id)
+				}
+			}
+			return "[" + strings.Join(ids, ", ") + "]"
+		})
+		return text, found
+	}
+	flag := func(text string) string {
+		text, found := cite(text)
+		if !found && len(strings.Fields(text)) >= minCitedWords {
+			check.Uncited++
+			return text + uncitedMark
+		}
+		return text
+	}
+
+	var out []string
+	var paragraph []string
+	fenced := false
+	flush := func() {
+		if len(paragraph) > 0 {
+			out = append(out, flag(strings.Join(paragraph, "\n")))
+			paragraph = nil
+		}
+	}
+	for _, line := range strings.Split(strings.TrimRight(report, "\n "), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			fenced = !fenced
+			out = append(out, line)
+		case fenced, strings.HasPrefix(trimmed, "#"), strings.HasPrefix(trimmed, "|"), trimmed == "---":
+			// Code, headings, tables and rules aren't claims, but a citation in them still counts
+			flush()
+			line, _ = cite(line)
+			out = append(out, line)
+		case trimmed == "":
+			flush()
+			out = append(out, line)
+		case listItemPattern.MatchString(line):
+			// Every list item is a claim of its own
+			flush()
+			paragraph = append(paragraph, line)
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+
+	result := strings.Join(out, "\n")
+	if len(check.Cited) > 0 {
+		var references strings.Builder
+		references.WriteString("\n\n## References\n")
+		for _, id := range check.Cited {
+			source := sources[id]
+			title := source.Title
+			if title == "" {
+				title = source.URL
+			}
+			fmt.Fprintf(&references, "\n- [%s] [%s](%s)", id, title, source.URL)
+			if !source.Fetched.IsZero() {
+				fmt.Fprintf(&references, ", fetched %s", source.Fetched.Format("2006-01-02 15:04 MST"))
+			}
+			if source.Hash != "" {
+				fmt.Fprintf(&references, ", sha256 %s", source.Hash[:min(12, len(source.Hash))])
+			}
+		}
+		result += references.String()
+	}
+
+	return result, check
+}
+
+// cite checks the citations of a report written by the run, unless it neither cites anything nor
+// could have, and traces the check in ctx
+func (t *researchTools) cite(ctx context.Context, report string) (string, citationCheck) {
+	sources := t.board.sources()
+	if len(sources) == 0 && !citationPattern.MatchString(report) {
+		return report, citationCheck{}
+	}
+
+	_, span := internal.StartSpan(ctx, internal.SpanTool, "citeReport")
+	span.Input = report
+	cited, check := citeReport(report, sources)
+	span.Output = cited
+	span.SetAttribute("cited", len(check.Cited))
+	span.SetAttribute("unknown", len(check.Unknown))
+	span.SetAttribute("uncited", check.Uncited)
+	span.Finish(nil)
+
+	if summary := check.summary(); summary != "" {
+		internal.Logger("agent").Warn("report has citation problems", "problems", summary)
+	}
+	return cited, check
+}
+
+// Tool to manage files, checking the citations of the Markdown reports it writes. Nothing is
+// written once a review left the draft unresolved.
+func (t *researchTools) manageFiles(ctx context.Context, args map[string]interface{}) swarmgo.Result {
+	action, _ := args["action"].(string)
+	path, _ := args["path"].(string)
+	content, ok := args["content"].(string)
+	if action == "write" {
+		if err := t.board.draftClosed(); err != nil {
+			return swarmgo.Result{
+				Data:    fmt.Sprintf("Error: %v", err),
+				Success: false,
+			}
+		}
+	}
+	if action != "write" || !ok || !strings.EqualFold(filepath.Ext(path), ".md") {
+		return manageFiles(args, nil)
+	}
+
+	content, check := t.cite(ctx, content)
+	written := make(map[string]interface{}, len(args))
+	for key, value := range args {
+		written[key] = value
+	}
+	written["content"] = content + "\n"
+
+	result := manageFiles(written, nil)
+	if summary := check.summary(); result.Success && summary != "" {
+		result.Data = fmt.Sprintf("%v, but %s. Fix them and write the file again.", result.Data, summary)
+	}
+	return result
+}
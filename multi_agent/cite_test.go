@@ -0,0 +1,144 @@
+package multiagent
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// testSources are the sources the test reports cite
+var testSources = map[string]blackboardSource{
+	"s1": {ID: "s1", URL: "https://example.com/go", Title: "Go", Hash: "0123456789abcdef0123"},
+	"s2": {ID: "s2", URL: "https://example.com/rust", Fetched: time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)},
+}
+
+// claim is a paragraph long enough to need a citation
+const claim = "Go compiles quickly and ships a single static binary for every supported platform"
+
+func TestCiteReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  string
+		want    string
+		cited   []string
+		unknown []string
+		uncited int
+	}{
+		{
+			name:   "cited paragraph",
+			report: claim + " [s1].",
+			want:   claim + " [s1].\n\n## References\n\n- [s1] [Go](https://example.com/go), sha256 0123456789ab",
+			cited:  []string{"s1"},
+		},
+		{
+			name:   "grouped citation in citing order",
+			report: claim + " [s2,s1].",
+			want: claim + " [s2, s1].\n\n## References\n\n" +
+				"- [s2] [https://example.com/rust](https://example.com/rust), fetched 2026-03-01 12:30 UTC\n" +
+				"- [s1] [Go](https://example.com/go), sha256 0123456789ab",
+			cited: []string{"s2", "s1"},
+		},
+		{
+			name:    "unknown id",
+			report:  claim + " [s1, s9].",
+			want:    claim + " [s1, s9?].\n\n## References\n\n- [s1] [Go](https://example.com/go), sha256 0123456789ab",
+			cited:   []string{"s1"},
+			unknown: []string{"s9"},
+		},
+		{
+			name:    "only unknown ids",
+			report:  claim + " [s7].",
+			want:    claim + " [s7?].",
+			unknown: []string{"s7"},
+		},
+		{
+			name:    "uncited paragraph",
+			report:  "# Report\n\n" + claim + ".\n\nShort line.",
+			want:    "# Report\n\n" + claim + "." + uncitedMark + "\n\nShort line.",
+			uncited: 1,
+		},
+		{
+			name:    "list items",
+			report:  "- " + claim + " [s1]\n- " + claim + "\n1. " + claim,
+			want:    "- " + claim + " [s1]\n- " + claim + uncitedMark + "\n1. " + claim + uncitedMark + "\n\n## References\n\n- [s1] [Go](https://example.com/go), sha256 0123456789ab",
+			cited:   []string{"s1"},
+			uncited: 2,
+		},
+		{
+			name:   "fenced code",
+			report: "```go\n// " + claim + "\n## Sources\n```\n\n" + claim + " [s2].",
+			want: "```go\n// " + claim + "\n## Sources\n```\n\n" + claim + " [s2].\n\n## References\n\n" +
+				"- [s2] [https://example.com/rust](https://example.com/rust), fetched 2026-03-01 12:30 UTC",
+			cited: []string{"s2"},
+		},
+		{
+			name:   "table",
+			report: "| Language | Claim |\n| --- | --- |\n| Go | " + claim + " [s1] |",
+			want:   "| Language | Claim |\n| --- | --- |\n| Go | " + claim + " [s1] |\n\n## References\n\n- [s1] [Go](https://example.com/go), sha256 0123456789ab",
+			cited:  []string{"s1"},
+		},
+		{
+			name:   "references of the writer replaced",
+			report: claim + " [s1].\n\n## Sources\n\n- [s1] Go, somewhere\n- [s2] Rust",
+			want:   claim + " [s1].\n\n## References\n\n- [s1] [Go](https://example.com/go), sha256 0123456789ab",
+			cited:  []string{"s1"},
+		},
+		{
+			name:   "sources section in the body kept",
+			report: "## Sources\n\nWe read two sources [s1].\n\n## Findings\n\n" + claim + " [s2].",
+			want: "## Sources\n\nWe read two sources [s1].\n\n## Findings\n\n" + claim + " [s2].\n\n## References\n\n" +
+				"- [s1] [Go](https://example.com/go), sha256 0123456789ab\n" +
+				"- [s2] [https://example.com/rust](https://example.com/rust), fetched 2026-03-01 12:30 UTC",
+			cited: []string{"s1", "s2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, check := citeReport(tt.report, testSources)
+			if got != tt.want {
+				t.Errorf("citeReport() report =\n%s\nwant\n%s", got, tt.want)
+			}
+			if !slices.Equal(check.Cited, tt.cited) || !slices.Equal(check.Unknown, tt.unknown) || check.Uncited != tt.uncited {
+				t.Errorf("citeReport() check = %+v, want cited %q, unknown %q, uncited %d", check, tt.cited, tt.unknown, tt.uncited)
+			}
+
+			// Checking the report again must not change it
+			again, recheck := citeReport(got, testSources)
+			if again != got {
+				t.Errorf("citeReport() again =\n%s\nwant\n%s", again, got)
+			}
+			if !slices.Equal(recheck.Cited, check.Cited) || !slices.Equal(recheck.Unknown, check.Unknown) || recheck.Uncited != check.Uncited {
+				t.Errorf("citeReport() again check = %+v, want %+v", recheck, check)
+			}
+		})
+	}
+}
+
+func TestReferencesStart(t *testing.T) {
+	tests := []struct {
+		name   string
+		report string
+		want   string
+	}{
+		{name: "none", report: "# Report\n\nText", want: ""},
+		{name: "final", report: "# Report\n\nText\n\n## References\n\n- a", want: "## References\n\n- a"},
+		{name: "any level and case", report: "Text\n#### sources\n- a", want: "#### sources\n- a"},
+		{name: "followed by a section", report: "## Sources\n\n- a\n\n## Results\n\nText", want: ""},
+		{name: "last of two", report: "## Sources\n\nText\n\n## Results\n\n## References\n- a", want: "## References\n- a"},
+		{name: "heading in code", report: "## References\n\n```sh\n# run it\n```", want: "## References\n\n```sh\n# run it\n```"},
+		{name: "only in code", report: "```md\n## References\n```", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if start := referencesStart(tt.report); start >= 0 {
+				got = tt.report[start:]
+			}
+			if got != tt.want {
+				t.Errorf("referencesStart() cuts %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
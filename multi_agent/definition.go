@@ -0,0 +1,470 @@
+package multiagent
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	"github.com/RB387/wolt-ai-agents-talk/orchestrator"
+	swarmgo "github.com/prathyushnallamothu/swarmgo"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultWorkflowFile is the built-in definition used when WORKFLOW_FILE isn't set
+const defaultWorkflowFile = "workflows/report.yaml"
+
+//go:embed workflows
+var embeddedWorkflows embed.FS
+
+// defaultAgentModel is used for agents without a model
+const defaultAgentModel = "gpt-4.1"
+
+// workflowTypes maps the definition's type to the swarmgo routing pattern
+var workflowTypes = map[string]swarmgo.WorkflowType{
+	"supervisor":    swarmgo.SupervisorWorkflow,
+	"hierarchical":  swarmgo.HierarchicalWorkflow,
+	"collaborative": swarmgo.CollaborativeWorkflow,
+}
+
+// routedTeams are the teams swarmgo's supervisor routing sends tasks to
+var routedTeams = []swarmgo.TeamType{
+	swarmgo.SupervisorTeam,
+	swarmgo.ResearchTeam,
+	swarmgo.DocumentTeam,
+	swarmgo.AnalysisTeam,
+	swarmgo.DeveloperTeam,
+}
+
+// nativeTypes are the patterns of the native engine
+var nativeTypes = []string{"supervisor", "hierarchical", "pipeline"}
+
+// workflowDefinition declares the agents of a workflow, their teams and the edges between them
+type workflowDefinition struct {
+	// Engine is swarmgo, the default, native for the orchestrator package or graph for a graph of agents
+	Engine string `yaml:"engine" json:"engine"`
+	// Type is supervisor, hierarchical or collaborative, or for the native engine supervisor, hierarchical or pipeline
+	Type string `yaml:"type" json:"type"`
+	// CyclePolicy is the native engine's handling of repeated handoffs: allow, reject or fail
+	CyclePolicy string `yaml:"cycle_policy" json:"cycle_policy"`
+	// MaxVisits limits the tasks the native engine hands to the same agent
+	MaxVisits int `yaml:"max_visits" json:"max_visits"`
+	// MaxSteps limits the agent turns of a native run
+	MaxSteps int `yaml:"max_steps" json:"max_steps"`
+	// FanOut lets agents with the dispatchResearch tool run subtasks on another agent concurrently
+	FanOut *fanOutDefinition `yaml:"fan_out" json:"fan_out"`
+	// Review lets an agent with the submitReview tool have the writer's drafts revised
+	Review *reviewDefinition `yaml:"review" json:"review"`
+	// Start is the agent receiving the request
+	Start  string            `yaml:"start" json:"start"`
+	Agents []agentDefinition `yaml:"agents" json:"agents"`
+	Teams  []teamDefinition  `yaml:"teams" json:"teams"`
+	Edges  []edgeDefinition  `yaml:"edges" json:"edges"`
+}
+
+// agentDefinition declares an agent. Its instructions are either a prompt of the prompt library
+// or an inline template, both rendered with internal.PromptVars.
+type agentDefinition struct {
+	Name string `yaml:"name" json:"name"`
+	// Description tells the native engine's delegating agents what the agent is for
+	Description  string   `yaml:"description" json:"description"`
+	Model        string   `yaml:"model" json:"model"`
+	Prompt       string   `yaml:"prompt" json:"prompt"`
+	Instructions string   `yaml:"instructions" json:"instructions"`
+	Tools        []string `yaml:"tools" json:"tools"`
+}
+
+type teamDefinition struct {
+	Name   string   `yaml:"name" json:"name"`
+	Leader string   `yaml:"leader" json:"leader"`
+	Agents []string `yaml:"agents" json:"agents"`
+}
+
+// fanOutDefinition configures the dispatchResearch tool. Zero limits take their defaults.
+type fanOutDefinition struct {
+	// Agent runs every subtask, each instance with a context of its own
+	Agent string `yaml:"agent" json:"agent"`
+	// Concurrency limits the subtasks running at once
+	Concurrency int `yaml:"concurrency" json:"concurrency"`
+	// MaxTasks limits the subtasks of a dispatch
+	MaxTasks int `yaml:"max_tasks" json:"max_tasks"`
+	// MaxModelCalls limits the model calls of a subtask
+	MaxModelCalls int `yaml:"max_model_calls" json:"max_model_calls"`
+	// Timeout limits how long a subtask runs, e.g. 2m
+	Timeout string `yaml:"timeout" json:"timeout"`
+}
+
+// reviewDefinition configures the reviews of drafts, also available to prompts as .Review
+type reviewDefinition struct {
+	// Agent reviews the drafts with the submitReview tool
+	Agent string `yaml:"agent" json:"agent"`
+	// Writer revises the drafts, it gets no more tasks once the revision rounds are used up
+	Writer string `yaml:"writer" json:"writer"`
+	// MaxRounds limits the revisions the reviews may request, 2 if zero
+	MaxRounds int `yaml:"max_rounds" json:"max_rounds"`
+}
+
+type edgeDefinition struct {
+	From string `yaml:"from" json:"from"`
+	To   string `yaml:"to" json:"to"`
+}
+
+// loadWorkflowDefinition reads the workflow at WORKFLOW_FILE, or the built-in report workflow,
+// and validates it against the registered tools and the prompt library
+func loadWorkflowDefinition(library *internal.PromptLibrary) (*workflowDefinition, error) {
+	path := os.Getenv("WORKFLOW_FILE")
+
+	var data []byte
+	var err error
+	if path == "" {
+		path = defaultWorkflowFile
+		data, err = embeddedWorkflows.ReadFile(path)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow: %w", err)
+	}
+
+	definition, err := parseWorkflowDefinition(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse workflow %s: %w", path, err)
+	}
+
+	if err := definition.validate(library); err != nil {
+		return nil, fmt.Errorf("invalid workflow %s: %w", path, err)
+	}
+
+	return definition, nil
+}
+
+// parseWorkflowDefinition decodes JSON for a .json extension and YAML otherwise, rejecting unknown fields
+func parseWorkflowDefinition(data []byte, ext string) (*workflowDefinition, error) {
+	var definition workflowDefinition
+
+	if strings.EqualFold(ext, ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&definition); err != nil {
+			return nil, err
+		}
+		return &definition, nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&definition); err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+// validate reports every problem of the definition at once
+func (d *workflowDefinition) validate(library *internal.PromptLibrary) error {
+	var errs []error
+
+	switch d.Engine {
+	case "", "swarmgo":
+		if _, ok := workflowTypes[d.Type]; !ok {
+			errs = append(errs, fmt.Errorf("unknown type %q, expected supervisor, hierarchical or collaborative", d.Type))
+		}
+	case "native":
+		if !slices.Contains(nativeTypes, d.Type) {
+			errs = append(errs, fmt.Errorf("unknown type %q for the native engine, expected %s", d.Type, strings.Join(nativeTypes, ", ")))
+		}
+		if _, err := orchestrator.ParseCyclePolicy(d.CyclePolicy); err != nil {
+			errs = append(errs, err)
+		}
+	case "graph":
+		// The edges are the graph, the type isn't used
+	default:
+		errs = append(errs, fmt.Errorf("unknown engine %q, expected swarmgo, native or graph", d.Engine))
+	}
+	if len(d.Agents) == 0 {
+		errs = append(errs, errors.New("no agents"))
+	}
+
+	agents := make(map[string]bool)
+	for i, agent := range d.Agents {
+		if agent.Name == "" {
+			errs = append(errs, fmt.Errorf("agent %d has no name", i+1))
+			continue
+		}
+		if agents[agent.Name] {
+			errs = append(errs, fmt.Errorf("agent %s is defined twice", agent.Name))
+		}
+		agents[agent.Name] = true
+
+		switch {
+		case agent.Prompt == "" && agent.Instructions == "":
+			errs = append(errs, fmt.Errorf("agent %s has neither a prompt nor instructions", agent.Name))
+		case agent.Prompt != "" && agent.Instructions != "":
+			errs = append(errs, fmt.Errorf("agent %s has both a prompt and instructions", agent.Name))
+		case agent.Prompt != "":
+			if _, err := library.Get(agent.Prompt); err != nil {
+				errs = append(errs, fmt.Errorf("agent %s: %w", agent.Name, err))
+			}
+		}
+
+		for _, tool := range agent.Tools {
+			if _, ok := findTool(tool); !ok {
+				errs = append(errs, fmt.Errorf("agent %s has unknown tool %s, expected one of %s", agent.Name, tool, strings.Join(toolNames(), ", ")))
+			}
+		}
+	}
+
+	if !agents[d.Start] {
+		errs = append(errs, fmt.Errorf("start agent %q is not defined", d.Start))
+	}
+
+	leaders := make(map[string]string)
+	for _, team := range d.Teams {
+		for _, agent := range team.Agents {
+			if !agents[agent] {
+				errs = append(errs, fmt.Errorf("team %s has unknown agent %s", team.Name, agent))
+			}
+		}
+		if team.Leader != "" {
+			if !slices.Contains(team.Agents, team.Leader) {
+				errs = append(errs, fmt.Errorf("leader %s of team %s is not a member of the team", team.Leader, team.Name))
+			}
+			leaders[team.Name] = team.Leader
+		}
+	}
+	if !d.native() && d.Type == "supervisor" && leaders[string(swarmgo.SupervisorTeam)] == "" {
+		errs = append(errs, errors.New("supervisor workflows need a supervisor team with a leader"))
+	}
+
+	edges := make(map[string][]string)
+	for _, edge := range d.Edges {
+		if !agents[edge.From] || !agents[edge.To] {
+			errs = append(errs, fmt.Errorf("edge %s -> %s connects an unknown agent", edge.From, edge.To))
+			continue
+		}
+		edges[edge.From] = append(edges[edge.From], edge.To)
+	}
+	if d.Engine == "native" && d.Type == "pipeline" {
+		for _, agent := range d.Agents {
+			if len(edges[agent.Name]) > 1 {
+				errs = append(errs, fmt.Errorf("pipeline stage %s has more than one next stage", agent.Name))
+			}
+		}
+	}
+
+	errs = append(errs, d.validateFanOut(agents)...)
+	errs = append(errs, d.validateReview(agents)...)
+	if d.FanOut != nil && agents[d.FanOut.Agent] {
+		// Subtasks reach the fan-out agent from every agent dispatching them
+		for _, agent := range d.Agents {
+			if slices.Contains(agent.Tools, fanOutTool) {
+				edges[agent.Name] = append(edges[agent.Name], d.FanOut.Agent)
+			}
+		}
+	}
+
+	// Every agent must be reachable from the start agent, otherwise it can never run
+	if agents[d.Start] {
+		reached := map[string]bool{d.Start: true}
+		queue := []string{d.Start}
+		for len(queue) > 0 {
+			agent := queue[0]
+			queue = queue[1:]
+			for _, next := range edges[agent] {
+				if !reached[next] {
+					reached[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+
+		for _, agent := range d.Agents {
+			if agent.Name != "" && !reached[agent.Name] {
+				errs = append(errs, fmt.Errorf("agent %s is unreachable from %s", agent.Name, d.Start))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateFanOut checks the fan-out settings and that only workflows with them use the dispatchResearch tool
+func (d *workflowDefinition) validateFanOut(agents map[string]bool) []error {
+	var errs []error
+
+	fanOut := d.FanOut
+	if fanOut == nil {
+		for _, agent := range d.Agents {
+			if slices.Contains(agent.Tools, fanOutTool) {
+				errs = append(errs, fmt.Errorf("agent %s has the %s tool, but the workflow has no fan_out", agent.Name, fanOutTool))
+			}
+		}
+		return errs
+	}
+
+	if !agents[fanOut.Agent] {
+		errs = append(errs, fmt.Errorf("fan_out agent %q is not defined", fanOut.Agent))
+	}
+	for _, agent := range d.Agents {
+		if agent.Name == fanOut.Agent && slices.Contains(agent.Tools, fanOutTool) {
+			errs = append(errs, fmt.Errorf("fan_out agent %s can't have the %s tool itself", agent.Name, fanOutTool))
+		}
+	}
+	if fanOut.Concurrency < 0 || fanOut.MaxTasks < 0 || fanOut.MaxModelCalls < 0 {
+		errs = append(errs, errors.New("fan_out limits can't be negative"))
+	}
+	if fanOut.Timeout != "" {
+		if timeout, err := time.ParseDuration(fanOut.Timeout); err != nil || timeout <= 0 {
+			errs = append(errs, fmt.Errorf("invalid fan_out timeout %q, expected a positive duration like 2m", fanOut.Timeout))
+		}
+	}
+	return errs
+}
+
+// validateReview checks the review settings and that only workflows with them use the submitReview tool
+func (d *workflowDefinition) validateReview(agents map[string]bool) []error {
+	var errs []error
+
+	review := d.Review
+	if review == nil {
+		for _, agent := range d.Agents {
+			if slices.Contains(agent.Tools, reviewTool) {
+				errs = append(errs, fmt.Errorf("agent %s has the %s tool, but the workflow has no review", agent.Name, reviewTool))
+			}
+		}
+		return errs
+	}
+
+	if !agents[review.Agent] {
+		errs = append(errs, fmt.Errorf("review agent %q is not defined", review.Agent))
+	}
+	switch {
+	case !agents[review.Writer]:
+		errs = append(errs, fmt.Errorf("review writer %q is not defined", review.Writer))
+	case review.Writer == review.Agent:
+		errs = append(errs, fmt.Errorf("review agent %s can't review its own drafts", review.Agent))
+	}
+	for _, agent := range d.Agents {
+		if agent.Name == review.Agent && !slices.Contains(agent.Tools, reviewTool) {
+			errs = append(errs, fmt.Errorf("review agent %s needs the %s tool", agent.Name, reviewTool))
+		}
+	}
+	if review.MaxRounds < 0 {
+		errs = append(errs, errors.New("review max_rounds can't be negative"))
+	}
+	return errs
+}
+
+// maxRevisions returns the revision rounds reviews may request, or 0 if drafts aren't reviewed
+func (d *workflowDefinition) maxRevisions() int {
+	switch {
+	case d.Review == nil:
+		return 0
+	case d.Review.MaxRounds == 0:
+		return defaultMaxRevisions
+	}
+	return d.Review.MaxRounds
+}
+
+// promptVars returns the variables of the agents' prompts, internal.PromptVars and the Review, if any,
+// with its limit of revision rounds
+func (d *workflowDefinition) promptVars(tools []string) map[string]any {
+	vars := internal.PromptVars(tools)
+	vars["Review"] = nil
+	if d.Review != nil {
+		vars["Review"] = reviewDefinition{Agent: d.Review.Agent, Writer: d.Review.Writer, MaxRounds: d.maxRevisions()}
+	}
+	return vars
+}
+
+// native reports whether the workflow runs on the orchestrator package instead of swarmgo
+func (d *workflowDefinition) native() bool {
+	return d.Engine == "native" || d.Engine == "graph"
+}
+
+// instructions returns the agent's prompt, from the library or parsed from its inline instructions
+func (a agentDefinition) instructions(library *internal.PromptLibrary) (*internal.Prompt, error) {
+	if a.Prompt != "" {
+		return library.Get(a.Prompt)
+	}
+	return internal.ParsePrompt(a.Name, "inline", a.Instructions)
+}
+
+// build adds the defined agents, teams and edges to workflow, giving each agent the enabled ones of its tools
+// and the blackboard in its instructions. It returns the agents' prompts.
+func (d *workflowDefinition) build(workflow *swarmgo.Workflow, library *internal.PromptLibrary, tools map[string]swarmgo.AgentFunction, board *blackboard, options internal.RunOptions) ([]*internal.Prompt, error) {
+	teams := make(map[string]swarmgo.TeamType)
+	for _, team := range d.Teams {
+		for _, agent := range team.Agents {
+			teams[agent] = swarmgo.TeamType(team.Name)
+		}
+		if d.Type == "supervisor" && !slices.Contains(routedTeams, swarmgo.TeamType(team.Name)) {
+			internal.Logger("agent").Warn("swarmgo's supervisor routing never sends tasks to this team", "team", team.Name)
+		}
+	}
+
+	var prompts []*internal.Prompt
+	for _, definition := range d.Agents {
+		var functions []swarmgo.AgentFunction
+		for _, name := range definition.Tools {
+			functions = append(functions, tools[name])
+		}
+		functions = enabledFunctions(options, functions)
+
+		prompt, err := definition.instructions(library)
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := prompt.Render(d.promptVars(functionNames(functions)))
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, prompt)
+
+		agent := &swarmgo.Agent{
+			Name:         definition.Name,
+			Instructions: instructions,
+			InstructionsFunc: func(contextVariables map[string]interface{}) string {
+				return instructions + board.brief()
+			},
+			Functions: functions,
+			Model:     options.ModelOr(definition.modelOr(defaultAgentModel)),
+		}
+		if team, ok := teams[definition.Name]; ok {
+			workflow.AddAgentToTeam(agent, team)
+		} else {
+			workflow.AddAgent(agent)
+		}
+	}
+
+	for _, team := range d.Teams {
+		if team.Leader == "" {
+			continue
+		}
+		if err := workflow.SetTeamLeader(team.Leader, swarmgo.TeamType(team.Name)); err != nil {
+			return nil, fmt.Errorf("error setting team leader: %w", err)
+		}
+	}
+
+	for _, edge := range d.Edges {
+		if err := workflow.ConnectAgents(edge.From, edge.To); err != nil {
+			return nil, fmt.Errorf("error connecting %s to %s: %w", edge.From, edge.To, err)
+		}
+	}
+
+	return prompts, nil
+}
+
+// modelOr returns the agent's model or the given default
+func (a agentDefinition) modelOr(model string) string {
+	if a.Model != "" {
+		return a.Model
+	}
+	return model
+}
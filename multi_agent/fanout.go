@@ -0,0 +1,130 @@
+package multiagent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	"github.com/RB387/wolt-ai-agents-talk/orchestrator"
+	"github.com/openai/openai-go/option"
+	swarmgo "github.com/prathyushnallamothu/swarmgo"
+)
+
+// fanOutTool is the tool dispatching research subtasks to instances of the fan_out agent
+const fanOutTool = "dispatchResearch"
+
+// Defaults of the fan_out limits
+const (
+	defaultFanOutConcurrency = 3
+	defaultFanOutTasks       = 5
+	defaultFanOutTimeout     = 3 * time.Minute
+)
+
+// fanOut runs research subtasks concurrently, each on an instance of the same agent with a context of its own
+type fanOut struct {
+	engine      *orchestrator.Engine
+	agent       *orchestrator.Agent
+	concurrency int
+	maxTasks    int
+	timeout     time.Duration
+}
+
+// newFanOut returns the fan-out of the definition on one of the agents, or nil without fan_out.
+// Subtasks call the model with their own HTTP client, bypassing swarmgo's usage transport,
+// as the model records their usage itself and they run concurrently with swarmgo's steps.
+func (d *workflowDefinition) newFanOut(agents map[string]*orchestrator.Agent, tracker *internal.UsageTracker) *fanOut {
+	if d.FanOut == nil {
+		return nil
+	}
+
+	fanOut := &fanOut{
+		agent:       agents[d.FanOut.Agent],
+		concurrency: d.FanOut.Concurrency,
+		maxTasks:    d.FanOut.MaxTasks,
+		timeout:     defaultFanOutTimeout,
+	}
+	if fanOut.concurrency == 0 {
+		fanOut.concurrency = defaultFanOutConcurrency
+	}
+	if fanOut.maxTasks == 0 {
+		fanOut.maxTasks = defaultFanOutTasks
+	}
+	if timeout, err := time.ParseDuration(d.FanOut.Timeout); err == nil {
+		fanOut.timeout = timeout
+	}
+
+	client := internal.NewOpenAIClient(option.WithHTTPClient(&http.Client{Transport: baseTransport}))
+	fanOut.engine = orchestrator.New(internal.NewOpenAIChatModel(client, tracker), tracker, orchestrator.Options{
+		MaxToolRounds: d.FanOut.MaxModelCalls,
+	})
+	return fanOut
+}
+
+// Tool to research several subtasks at once and get the merged findings, tracing them in ctx
+func (t *researchTools) dispatch(ctx context.Context, args map[string]interface{}) swarmgo.Result {
+	if t.fanOut == nil {
+		return swarmgo.Result{
+			Data:    "Error: research can't be dispatched in this workflow",
+			Success: false,
+		}
+	}
+
+	list, _ := args["tasks"].([]interface{})
+	var tasks []string
+	for _, item := range list {
+		if task, ok := item.(string); ok && strings.TrimSpace(task) != "" {
+			tasks = append(tasks, strings.TrimSpace(task))
+		}
+	}
+	if len(tasks) == 0 {
+		return swarmgo.Result{
+			Data:    "Error: tasks parameter is required and must be a list of strings",
+			Success: false,
+		}
+	}
+
+	var dropped []string
+	if len(tasks) > t.fanOut.maxTasks {
+		tasks, dropped = tasks[:t.fanOut.maxTasks], tasks[t.fanOut.maxTasks:]
+	}
+
+	internal.Logger("agent").Info("dispatching research", "agent", t.fanOut.agent.Name, "tasks", len(tasks), "concurrency", t.fanOut.concurrency)
+	subtasks := t.fanOut.engine.FanOut(ctx, t.fanOut.agent, tasks, t.fanOut.concurrency, t.fanOut.timeout)
+
+	var succeeded int
+	for _, subtask := range subtasks {
+		if subtask.Err == nil {
+			succeeded++
+		}
+	}
+
+	return swarmgo.Result{
+		Data:    mergeFindings(subtasks, dropped),
+		Success: succeeded > 0,
+	}
+}
+
+// mergeFindings lists the findings of every subtask under its task, for the writer to use
+func mergeFindings(subtasks []orchestrator.Subtask, dropped []string) string {
+	var findings strings.Builder
+	fmt.Fprintf(&findings, "Findings of %d research subtasks:", len(subtasks))
+	for i, subtask := range subtasks {
+		fmt.Fprintf(&findings, "\n\n## Subtask %d: %s\n", i+1, subtask.Task)
+		if subtask.Err != nil {
+			fmt.Fprintf(&findings, "Failed: %v", subtask.Err)
+			continue
+		}
+		findings.WriteString(strings.TrimSpace(subtask.Output))
+	}
+
+	if len(dropped) > 0 {
+		fmt.Fprintf(&findings, "\n\nNot researched, only %d subtasks may be dispatched at once:", len(subtasks))
+		for _, task := range dropped {
+			fmt.Fprintf(&findings, "\n- %s", task)
+		}
+	}
+	return findings.String()
+}
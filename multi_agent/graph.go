@@ -0,0 +1,209 @@
+package multiagent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/RB387/wolt-ai-agents-talk/graph"
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	"github.com/RB387/wolt-ai-agents-talk/orchestrator"
+)
+
+// routeEnd is the route an agent picks to finish a graph workflow
+const routeEnd = "END"
+
+// graphState is the state of a workflow run, the state of the graph engine and what every engine checkpoints
+type graphState struct {
+	Query   string        `json:"query,omitempty"`
+	Outputs []graphOutput `json:"outputs,omitempty"`
+	// Next is the agent the last agent picked, or END
+	Next string `json:"next,omitempty"`
+	// Variables are the context variables shared by the agents
+	Variables map[string]any `json:"variables,omitempty"`
+	// Answers are the human's answers to the agents' questions
+	Answers []humanAnswer `json:"answers,omitempty"`
+	// Blackboard is what the agents shared on the blackboard
+	Blackboard *blackboardState `json:"blackboard,omitempty"`
+	// Pending is the question the run waits for a human to answer
+	Pending string `json:"pending,omitempty"`
+}
+
+// graphOutput is the answer of an agent
+type graphOutput struct {
+	Agent string `json:"agent"`
+	Text  string `json:"text"`
+}
+
+type humanAnswer struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// addOutput returns the state with an agent's answer added, leaving s unchanged. The agents'
+// messages aren't kept, as no engine can continue a turn: a resumed run re-prompts the next
+// agent with the work so far, see task.
+func (s graphState) addOutput(agent, text string) graphState {
+	s.Outputs = append(slices.Clone(s.Outputs), graphOutput{Agent: agent, Text: text})
+	return s
+}
+
+// task shows an agent the request, the human's answers and everyone's work so far
+func (s graphState) task() string {
+	if len(s.Outputs) == 0 && len(s.Answers) == 0 {
+		return s.Query
+	}
+
+	var task strings.Builder
+	task.WriteString(s.Query)
+	if len(s.Answers) > 0 {
+		task.WriteString("\n\nAnswers from the human:")
+		for _, answer := range s.Answers {
+			fmt.Fprintf(&task, "\n- %s %s", answer.Question, strings.TrimSpace(answer.Answer))
+		}
+	}
+	if len(s.Outputs) > 0 {
+		task.WriteString("\n\nWork so far:")
+		for _, output := range s.Outputs {
+			fmt.Fprintf(&task, "\n\n[%s]: %s", output.Agent, output.Text)
+		}
+	}
+	return task.String()
+}
+
+// result returns the last answer as the output, with a step per answer
+func (s graphState) result() *orchestrator.Result {
+	result := &orchestrator.Result{}
+	for i, output := range s.Outputs {
+		result.Steps = append(result.Steps, orchestrator.Step{Number: i + 1, Agent: output.Agent, Output: output.Text})
+		result.Output = output.Text
+	}
+	return result
+}
+
+// outgoing returns the agents each agent's edges lead to
+func (d *workflowDefinition) outgoing() map[string][]string {
+	edges := make(map[string][]string)
+	for _, edge := range d.Edges {
+		edges[edge.From] = append(edges[edge.From], edge.To)
+	}
+	return edges
+}
+
+// buildGraph returns the workflow as a graph with a node per agent. Agents with a single edge
+// pass the work on, agents without edges finish the run, and the start agent and agents with
+// several edges pick the next agent or END with a NEXT line at the end of their answer.
+func (d *workflowDefinition) buildGraph(agents map[string]*orchestrator.Agent, engine *orchestrator.Engine, maxSteps int) *graph.Graph[graphState] {
+	workflow := graph.New[graphState]()
+	workflow.SetMaxSteps(maxSteps)
+
+	edges := d.outgoing()
+	for _, definition := range d.Agents {
+		name := definition.Name
+		targets := edges[name]
+		agent := agents[name]
+
+		routed := name == d.Start || len(targets) > 1
+		if routed {
+			routes := map[string]string{routeEnd: graph.End}
+			for _, target := range targets {
+				routes[target] = target
+			}
+
+			agent = routingAgent(agent, targets)
+			workflow.AddConditionalEdges(name, func(state graphState) string {
+				if _, ok := routes[state.Next]; !ok {
+					internal.Logger("agent").Warn("agent picked an unknown next agent, finishing", "agent", name, "next", state.Next)
+					return routeEnd
+				}
+				return state.Next
+			}, routes)
+		} else if len(targets) == 1 {
+			workflow.AddEdge(name, targets[0])
+		} else {
+			workflow.AddEdge(name, graph.End)
+		}
+
+		workflow.AddNode(name, func(ctx context.Context, state graphState) (graphState, error) {
+			shared := orchestrator.NewState()
+			for key, value := range state.Variables {
+				shared.Set(key, value)
+			}
+
+			task := state.task()
+			result, err := engine.Run(ctx, agent, task, shared)
+			if err != nil {
+				return state, err
+			}
+
+			output, next := result.Output, ""
+			if routed {
+				output, next = cutNext(output)
+			}
+			state = state.addOutput(name, output)
+			state.Next = next
+			state.Variables = shared.Values()
+
+			return state, nil
+		})
+	}
+	workflow.SetStart(d.Start)
+
+	return workflow
+}
+
+// routingAgent returns a copy of the agent told to pick the next agent
+func routingAgent(agent *orchestrator.Agent, targets []string) *orchestrator.Agent {
+	routing := *agent
+	routing.Instructions += fmt.Sprintf("\n\nEnd your answer with a line \"NEXT: <agent>\" naming who continues: %s, or %s once the request is answered.",
+		strings.Join(targets, ", "), routeEnd)
+	return &routing
+}
+
+// cutNext removes the NEXT line from an answer and returns the agent it names
+func cutNext(output string) (string, string) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.Trim(strings.TrimSpace(lines[i]), "*`")
+		if len(line) > 5 && strings.EqualFold(line[:5], "next:") {
+			next := strings.Trim(strings.TrimSpace(line[5:]), "*`\"'.")
+			if strings.EqualFold(next, routeEnd) {
+				next = routeEnd
+			}
+			return strings.TrimSpace(strings.Join(append(lines[:i], lines[i+1:]...), "\n")), next
+		}
+	}
+	return output, routeEnd
+}
+
+// ExportGraph renders the workflow definition as a graph in the mermaid or dot format
+func ExportGraph(format string) (string, error) {
+	internal.LoadEnv()
+
+	library, err := internal.LoadPrompts()
+	if err != nil {
+		return "", err
+	}
+	definition, err := loadWorkflowDefinition(library)
+	if err != nil {
+		return "", err
+	}
+
+	agents, _, err := definition.nativeAgents(library, nil, nil, internal.RunOptions{})
+	if err != nil {
+		return "", err
+	}
+	workflow := definition.buildGraph(agents, nil, 0)
+	if err := workflow.Validate(); err != nil {
+		return "", fmt.Errorf("invalid graph: %w", err)
+	}
+
+	switch format {
+	case "mermaid":
+		return workflow.Mermaid(), nil
+	case "dot":
+		return workflow.DOT(), nil
+	}
+	return "", fmt.Errorf("unknown graph format %q, expected mermaid or dot", format)
+}
@@ -0,0 +1,327 @@
+package multiagent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/RB387/wolt-ai-agents-talk/graph"
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	"github.com/RB387/wolt-ai-agents-talk/orchestrator"
+	swarmgo "github.com/prathyushnallamothu/swarmgo"
+)
+
+// defaultMaxSteps limits the agent turns of a native workflow without max_steps
+const defaultMaxSteps = 20
+
+// nativeTools adapts the registered tools to the orchestrator, which traces and records tool calls itself.
+// The tools of contextHandlers trace within the tool call.
+func nativeTools(research *researchTools) map[string]orchestrator.Tool {
+	handlers := toolHandlers(research)
+	traced := contextHandlers(research)
+
+	bound := make(map[string]orchestrator.Tool, len(tools))
+	for _, tool := range tools {
+		handler := handlers[tool.Name]
+		bound[tool.Name] = orchestrator.Tool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.Parameters,
+			Run: func(ctx context.Context, state *orchestrator.State, args map[string]any) (string, error) {
+				var result swarmgo.Result
+				if traced, ok := traced[tool.Name]; ok {
+					result = traced(ctx, args)
+				} else {
+					result = handler(args, state.Values())
+				}
+				if result.Error != nil {
+					return "", result.Error
+				}
+				return fmt.Sprint(result.Data), nil
+			},
+		}
+	}
+	return bound
+}
+
+// nativeAgents returns the orchestrator agents of the definition by name, with the enabled ones of their tools
+// and the blackboard, if any, and their prompts
+func (d *workflowDefinition) nativeAgents(library *internal.PromptLibrary, tools map[string]orchestrator.Tool, board *blackboard, options internal.RunOptions) (map[string]*orchestrator.Agent, []*internal.Prompt, error) {
+	agents := make(map[string]*orchestrator.Agent)
+	var prompts []*internal.Prompt
+	for _, definition := range d.Agents {
+		var agentTools []orchestrator.Tool
+		var names []string
+		for _, name := range definition.Tools {
+			if options.ToolEnabled(name) {
+				agentTools = append(agentTools, tools[name])
+				names = append(names, name)
+			}
+		}
+
+		prompt, err := definition.instructions(library)
+		if err != nil {
+			return nil, nil, err
+		}
+		instructions, err := prompt.Render(d.promptVars(names))
+		if err != nil {
+			return nil, nil, err
+		}
+		prompts = append(prompts, prompt)
+
+		agent := &orchestrator.Agent{
+			Name:         definition.Name,
+			Description:  definition.Description,
+			Model:        options.ModelOr(definition.modelOr(defaultAgentModel)),
+			Instructions: instructions,
+			Tools:        agentTools,
+		}
+		if board != nil {
+			agent.Briefing = board.brief
+		}
+		agents[definition.Name] = agent
+	}
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+
+	return agents, prompts, nil
+}
+
+// buildNative returns the orchestrator node of the start agent.
+// An agent supervises the agents its edges lead to, except its own supervisors, as edges back
+// to them are the results it returns. A pipeline follows the edges from stage to stage.
+func (d *workflowDefinition) buildNative(agents map[string]*orchestrator.Agent) orchestrator.Node {
+	edges := d.outgoing()
+	if d.Type == "pipeline" {
+		pipeline := &orchestrator.Pipeline{Name: "pipeline"}
+		visited := make(map[string]bool)
+		for name := d.Start; name != "" && !visited[name]; {
+			visited[name] = true
+			pipeline.Stages = append(pipeline.Stages, agents[name])
+
+			next := ""
+			if len(edges[name]) > 0 {
+				next = edges[name][0]
+			}
+			name = next
+		}
+		return pipeline
+	}
+
+	supervisors := make(map[string]bool)
+	var node func(name string) orchestrator.Node
+	node = func(name string) orchestrator.Node {
+		supervisors[name] = true
+		defer delete(supervisors, name)
+
+		var workers []orchestrator.Node
+		for _, next := range edges[name] {
+			if !supervisors[next] {
+				workers = append(workers, node(next))
+			}
+		}
+		if len(workers) == 0 {
+			return agents[name]
+		}
+		return &orchestrator.Supervisor{Lead: agents[name], Workers: workers}
+	}
+
+	return node(d.Start)
+}
+
+// nativeWorkflow is a workflow definition run by the orchestrator package instead of swarmgo,
+// either as the orchestrator's patterns or as a graph of agents
+type nativeWorkflow struct {
+	// name is the engine, naming the run span
+	name     string
+	start    string
+	engine   *orchestrator.Engine
+	root     orchestrator.Node
+	graph    *graph.Graph[graphState]
+	research *researchTools
+	// prompts are the agents' instruction prompts, recorded in the trace
+	prompts []*internal.Prompt
+	// onStep checkpoints the agent turns of the query being executed
+	onStep func(step orchestrator.Step)
+}
+
+// newNativeWorkflow creates the native workflow of the definition, recording usage in tracker.
+// Without max_visits, the iteration limit caps the tasks handed to each agent.
+func newNativeWorkflow(definition *workflowDefinition, library *internal.PromptLibrary, tracker *internal.UsageTracker, kb *internal.KnowledgeBase, options internal.RunOptions) (*nativeWorkflow, error) {
+	policy, err := orchestrator.ParseCyclePolicy(definition.CyclePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	workflow := &nativeWorkflow{
+		name:     definition.Engine,
+		start:    definition.Start,
+		research: newResearchTools(kb),
+	}
+
+	agents, prompts, err := definition.nativeAgents(library, nativeTools(workflow.research), workflow.research.board, options)
+	if err != nil {
+		return nil, err
+	}
+	workflow.prompts = prompts
+	workflow.research.fanOut = definition.newFanOut(agents, tracker)
+	workflow.research.maxRevisions = definition.maxRevisions()
+
+	maxVisits := definition.MaxVisits
+	if maxVisits == 0 {
+		maxVisits = options.MaxIter
+	}
+	maxSteps := definition.MaxSteps
+	if maxSteps == 0 {
+		maxSteps = defaultMaxSteps
+	}
+
+	// Once a review left the draft unresolved, the writer gets no more revisions
+	var checkHandoff func(from, to string) error
+	if definition.Review != nil {
+		checkHandoff = func(from, to string) error {
+			if to != definition.Review.Writer {
+				return nil
+			}
+			return workflow.research.board.draftClosed()
+		}
+	}
+
+	model := internal.NewOpenAIChatModel(internal.NewOpenAIClient(), tracker)
+	workflow.engine = orchestrator.New(model, tracker, orchestrator.Options{
+		MaxSteps:     maxSteps,
+		MaxVisits:    maxVisits,
+		CyclePolicy:  policy,
+		CheckHandoff: checkHandoff,
+		Temperature:  options.Temperature,
+		OnStep: func(step orchestrator.Step) {
+			if workflow.onStep != nil {
+				workflow.onStep(step)
+			}
+		},
+	})
+
+	if definition.Engine == "graph" {
+		workflow.graph = definition.buildGraph(agents, workflow.engine, maxSteps)
+	} else {
+		workflow.root = definition.buildNative(agents)
+	}
+	return workflow, nil
+}
+
+// run answers a query, tracing it as a run. The engine traces the agent turns and handoffs, the graph its nodes.
+func (w *nativeWorkflow) run(ctx context.Context, query string, from *workflowCheckpoint, checkpoints *runCheckpoints) (output *workflowOutput, err error) {
+	ctx, span := internal.StartSpan(ctx, internal.SpanRun, w.name)
+	span.Input = query
+	span.SetAttribute("prompt", internal.PromptIDs(w.prompts...))
+	defer func() {
+		if output != nil {
+			span.Output = output.answer
+			span.SetAttribute("steps", output.steps)
+		}
+		span.Finish(err)
+	}()
+
+	current := workflowCheckpoint{State: graphState{Query: query}, Next: []string{w.start}}
+	if from != nil {
+		current = *from
+	}
+	w.research.start(from, checkpoints)
+
+	var result *orchestrator.Result
+	if w.graph != nil {
+		w.graph.SetCheckpointer(graphCheckpointer{checkpoints: checkpoints})
+
+		var state graphState
+		state, err = w.graph.Resume(ctx, graph.Checkpoint[graphState]{
+			Step:    current.Step,
+			State:   current.State,
+			Next:    current.Next,
+			Waiting: current.Waiting,
+		})
+		result = state.result()
+	} else {
+		result, err = w.runEngine(ctx, current, checkpoints)
+	}
+	answer, _ := w.research.cite(ctx, result.Output)
+
+	return &workflowOutput{
+		answer: answer,
+		steps:  len(result.Steps),
+		print: func(w io.Writer, usage internal.UsageReport) {
+			printNativeSteps(w, result, usage)
+		},
+	}, err
+}
+
+// runEngine hands the task to the root node, checkpointing every agent turn. A resumed query starts
+// over at the root with the work so far, as the orchestrator can't continue a turn.
+func (w *nativeWorkflow) runEngine(ctx context.Context, from workflowCheckpoint, checkpoints *runCheckpoints) (*orchestrator.Result, error) {
+	state, step := from.State, from.Step
+
+	shared := orchestrator.NewState()
+	for key, value := range state.Variables {
+		shared.Set(key, value)
+	}
+
+	w.onStep = func(turn orchestrator.Step) {
+		if turn.Error != "" {
+			return
+		}
+
+		step++
+		state = state.addOutput(turn.Agent, turn.Output)
+		state.Variables = shared.Values()
+		checkpoints.saveLogged(workflowCheckpoint{Step: step, State: state, Next: []string{w.start}})
+	}
+	defer func() {
+		w.onStep = nil
+	}()
+
+	result, err := w.engine.Run(ctx, w.root, state.task(), shared)
+	if err == nil {
+		checkpoints.saveLogged(workflowCheckpoint{Step: step, State: state})
+	}
+	return result, err
+}
+
+// graphCheckpointer saves the graph engine's checkpoints with the run's
+type graphCheckpointer struct {
+	checkpoints *runCheckpoints
+}
+
+func (c graphCheckpointer) Save(ctx context.Context, checkpoint graph.Checkpoint[graphState]) error {
+	c.checkpoints.saveLogged(workflowCheckpoint{
+		Step:    checkpoint.Step,
+		Time:    checkpoint.Time,
+		State:   checkpoint.State,
+		Next:    checkpoint.Next,
+		Waiting: checkpoint.Waiting,
+	})
+	return nil
+}
+
+// printNativeSteps prints the agent turns of a native workflow run
+func printNativeSteps(w io.Writer, result *orchestrator.Result, usage internal.UsageReport) {
+	fmt.Fprintf(w, "\n\033[96mWorkflow Summary\033[0m\n")
+	fmt.Fprintf(w, "Total Steps: %d\n", len(result.Steps))
+	fmt.Fprintf(w, "Total Tokens: %d\n", usage.Total.Usage.PromptTokens+usage.Total.Usage.CompletionTokens)
+	fmt.Fprintf(w, "Total Cost: $%.4f\n", usage.Total.Cost)
+
+	for _, step := range result.Steps {
+		fmt.Fprintf(w, "\n\033[95mStep %d Results:\033[0m\n", step.Number)
+		fmt.Fprintf(w, "Agent: %s\n", step.Agent)
+		if !step.Start.IsZero() {
+			fmt.Fprintf(w, "Duration: %v\n", step.End.Sub(step.Start))
+		}
+		if step.Error != "" {
+			fmt.Fprintf(w, "\033[91mError: %v\033[0m\n", step.Error)
+			continue
+		}
+		if step.Task != "" {
+			fmt.Fprintf(w, "\033[92m[Task]\033[0m: %s\n", step.Task)
+		}
+		fmt.Fprintf(w, "\033[94m[%s]\033[0m: %s\n", step.Agent, step.Output)
+		fmt.Fprintln(w, "-----------------------------------------")
+	}
+}
@@ -0,0 +1,144 @@
+package multiagent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+)
+
+// Resume continues a checkpointed run from its last checkpoint, or from an earlier step if step isn't negative.
+// A run continued from an earlier step is saved as a new run. The workflow and options of the run are used,
+// except for the output format and quiet mode of options.
+func Resume(ctx context.Context, id string, step int, options internal.RunOptions) error {
+	internal.LoadEnv()
+
+	store := checkpointStoreFromEnv()
+	if store == nil {
+		return fmt.Errorf("checkpoints are turned off with CHECKPOINTS=0")
+	}
+
+	if err := store.valid(id); err != nil {
+		return err
+	}
+	record, saved, err := store.open(id)
+	if err != nil {
+		return err
+	}
+	if len(saved) == 0 {
+		return fmt.Errorf("run %s has no checkpoints", id)
+	}
+
+	index := len(saved) - 1
+	if step >= 0 {
+		index = -1
+		for i, checkpoint := range saved {
+			if checkpoint.Step == step {
+				index = i
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("run %s has no checkpoint at step %d, the last one is at step %d", id, step, saved[len(saved)-1].Step)
+		}
+	}
+	from := saved[index]
+	if from.finished() {
+		return fmt.Errorf("run %s finished at step %d, choose an earlier step with --step to run it again from there", id, from.Step)
+	}
+
+	var checkpoints *runCheckpoints
+	if index == len(saved)-1 {
+		checkpoints, err = store.append(record.ID)
+	} else {
+		checkpoints, err = store.fork(*record, saved[:index+1])
+	}
+	if err != nil {
+		return err
+	}
+	defer checkpoints.close()
+	checkpoints.resumeFrom(from)
+
+	if question := from.State.Pending; question != "" {
+		result := getHumanInput(map[string]interface{}{"question": question}, nil)
+		checkpoints.answered(question, fmt.Sprint(result.Data))
+		from = checkpoints.last
+	}
+
+	runOptions := record.Options
+	runOptions.Output, runOptions.Quiet = options.Output, options.Quiet
+
+	tracker, err := internal.NewUsageTrackerFromEnv()
+	if err != nil {
+		return fmt.Errorf("error loading price table: %w", err)
+	}
+
+	kb, err := internal.OpenKnowledgeBaseFromEnv(ctx, tracker)
+	if err != nil {
+		return fmt.Errorf("error opening knowledge base: %w", err)
+	}
+
+	library, err := internal.LoadPrompts()
+	if err != nil {
+		return err
+	}
+	if err := record.Definition.validate(library); err != nil {
+		return fmt.Errorf("invalid workflow of run %s: %w", id, err)
+	}
+
+	runner, err := newRunner(record.Definition, library, tracker, kb, runOptions)
+	if err != nil {
+		return err
+	}
+
+	internal.Logger("agent").Info("resuming run", "run", checkpoints.id, "step", from.Step, "next", strings.Join(from.Next, ","))
+	runQuery(ctx, runner, record.Query, &from, checkpoints, tracker, runOptions)
+
+	return finishRun(tracker, runOptions)
+}
+
+// ListRuns prints the checkpointed runs, the latest first, with their last step and what they wait for
+func ListRuns(w io.Writer) error {
+	internal.LoadEnv()
+
+	store := checkpointStoreFromEnv()
+	if store == nil {
+		return fmt.Errorf("checkpoints are turned off with CHECKPOINTS=0")
+	}
+
+	ids, err := store.list()
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "RUN\tSTEP\tSTATUS\tQUERY")
+	for _, id := range ids {
+		record, saved, err := store.open(id)
+		if err != nil {
+			internal.Logger("agent").Warn("skipping unreadable run", "run", id, "error", err)
+			continue
+		}
+
+		status, step := "no checkpoints", 0
+		if len(saved) > 0 {
+			last := saved[len(saved)-1]
+			step = last.Step
+			switch {
+			case last.State.Pending != "":
+				status = "waiting for an answer"
+			case last.finished():
+				status = "finished"
+			default:
+				status = "next: " + strings.Join(last.Next, ", ")
+			}
+		}
+
+		query := truncateText(strings.Join(strings.Fields(record.Query), " "), 57)
+		fmt.Fprintf(table, "%s\t%d\t%s\t%s\n", id, step, status, query)
+	}
+
+	return table.Flush()
+}
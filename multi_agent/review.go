@@ -0,0 +1,128 @@
+package multiagent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	swarmgo "github.com/prathyushnallamothu/swarmgo"
+)
+
+// reviewTool is the tool the review agent submits its review of a draft with
+const reviewTool = "submitReview"
+
+// defaultMaxRevisions is the limit of revision rounds of a review without max_rounds
+const defaultMaxRevisions = 2
+
+// Verdicts of a review. A revision requested when no rounds are left is unresolved.
+const (
+	verdictApprove    = "approve"
+	verdictRevise     = "revise"
+	verdictUnresolved = "unresolved"
+)
+
+// reviewProblems are the problems a review issue may report
+var reviewProblems = []string{"unsupported", "contradicted"}
+
+// render describes the review, as a revision request for the writer while rounds are left
+func (r blackboardReview) render() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Review %d, %d of %d revision rounds used: ", r.Round, r.Revisions, r.MaxRevisions)
+	switch r.Verdict {
+	case verdictApprove:
+		out.WriteString("the draft is approved, finish.")
+	case verdictRevise:
+		out.WriteString("the writer must revise the draft and have it reviewed again.")
+	default:
+		out.WriteString("no revision rounds are left, finish with the draft as it is.")
+	}
+	if r.Summary != "" {
+		fmt.Fprintf(&out, "\n%s", r.Summary)
+	}
+
+	for i, issue := range r.Issues {
+		fmt.Fprintf(&out, "\n%d. %s: %q", i+1, issue.Problem, issue.Claim)
+		if issue.Source != "" {
+			fmt.Fprintf(&out, " [%s]", issue.Source)
+		}
+		if issue.Fix != "" {
+			fmt.Fprintf(&out, " Fix: %s", issue.Fix)
+		}
+	}
+	return out.String()
+}
+
+// reviewIssues reads the issues argument of submitReview
+func reviewIssues(args map[string]interface{}) ([]reviewIssue, error) {
+	list, _ := args["issues"].([]interface{})
+
+	var issues []reviewIssue
+	for i, item := range list {
+		fields, _ := item.(map[string]interface{})
+		claim, _ := fields["claim"].(string)
+		problem, _ := fields["problem"].(string)
+		source, _ := fields["source"].(string)
+		fix, _ := fields["fix"].(string)
+
+		issue := reviewIssue{
+			Claim:   strings.TrimSpace(claim),
+			Problem: strings.TrimSpace(problem),
+			Source:  strings.Trim(strings.TrimSpace(source), "[]"),
+			Fix:     strings.TrimSpace(fix),
+		}
+		if issue.Claim == "" || !slices.Contains(reviewProblems, issue.Problem) {
+			return nil, fmt.Errorf("issue %d needs a claim and a problem, one of %s", i+1, strings.Join(reviewProblems, ", "))
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// Tool to submit the review of a draft, recorded on the blackboard and traced in ctx
+func (t *researchTools) submitReview(ctx context.Context, args map[string]interface{}) swarmgo.Result {
+	if t.maxRevisions == 0 {
+		return swarmgo.Result{
+			Data:    "Error: drafts aren't reviewed in this workflow",
+			Success: false,
+		}
+	}
+
+	verdict, _ := args["verdict"].(string)
+	summary, _ := args["summary"].(string)
+	issues, err := reviewIssues(args)
+	if err != nil {
+		return swarmgo.Result{
+			Data:    fmt.Sprintf("Error: %v", err),
+			Success: false,
+		}
+	}
+	switch {
+	case verdict != verdictApprove && verdict != verdictRevise:
+		return swarmgo.Result{
+			Data:    "Error: verdict must be approve or revise",
+			Success: false,
+		}
+	case verdict == verdictRevise && len(issues) == 0:
+		return swarmgo.Result{
+			Data:    "Error: a revision needs the issues to fix",
+			Success: false,
+		}
+	}
+
+	review := t.board.addReview(blackboardReview{
+		Verdict: verdict,
+		Summary: strings.TrimSpace(summary),
+		Issues:  issues,
+	}, t.maxRevisions)
+	t.board.trace(ctx, fmt.Sprintf("Review %d: %s, %d issues", review.Round, review.Verdict, len(review.Issues)))
+	if review.Verdict == verdictUnresolved {
+		internal.Logger("agent").Warn("revision limit reached with open issues", "rounds", review.MaxRevisions, "issues", len(review.Issues))
+	}
+
+	return swarmgo.Result{
+		Data:    review.render(),
+		Success: true,
+	}
+}
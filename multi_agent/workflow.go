@@ -0,0 +1,1107 @@
+// Package multiagent composes the agents of a workflow definition with swarmgo or the native
+// orchestrator, by default a supervisor, a writer, a scraper and a critic agent
+package multiagent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+	swarmgo "github.com/prathyushnallamothu/swarmgo"
+	"github.com/prathyushnallamothu/swarmgo/llm"
+)
+
+// Tool to search the web
+func searchWeb(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+	query, ok := args["query"].(string)
+	if !ok {
+		return swarmgo.Result{
+			Data: "Error: query parameter is required and must be a string",
+			Success: false,
+		}
+	}
+
+	query = strings.ReplaceAll(query, `"`, "")
+	searchClient := internal.NewSearchClient()
+	results, err := searchClient.Search(query)
+	if err != nil {
+		return swarmgo.Result{
+			Error: fmt.Errorf("failed to search the web: %w", err),
+			Success: false,
+		}
+	}
+
+	if len(results) == 0 {
+		return swarmgo.Result{
+			Data: "No results found",
+			Success: false,
+		}
+	}
+
+	var resultText strings.Builder
+	for i, result := range results {
+		if i >= searchResults() {
+			break
+		}
+		resultText.WriteString(fmt.Sprintf("%d. %s - %s\n", i+1, result.URL, result.URL))
+	}
+
+	return swarmgo.Result{
+		Data: resultText.String(),
+		Success: true,
+	}
+}
+
+// searchResults is the number of results searchWeb returns, SEARCH_RESULTS or 2
+func searchResults() int {
+	if n, err := strconv.Atoi(os.Getenv("SEARCH_RESULTS")); err == nil && n > 0 {
+		return n
+	}
+	return 2
+}
+
+// researchTools hold the pages scraped during the run, so agents read them chunk by chunk
+// instead of passing whole pages around, the knowledge base of our own documents, the
+// blackboard shared by the agents, the fan-out of research subtasks, the revision rounds
+// reviews may request and the checkpoints of the query being executed, to save the
+// questions asked to a human
+type researchTools struct {
+	pages        *internal.PageStore
+	kb           *internal.KnowledgeBase
+	board        *blackboard
+	fanOut       *fanOut
+	maxRevisions int
+	checkpoints  *runCheckpoints
+	// ctx is the span context of the swarmgo query being executed, as swarmgo doesn't pass one to
+	// tools. The tools of contextHandlers trace in it.
+	ctx context.Context
+}
+
+// newResearchTools creates the research tools of a workflow
+func newResearchTools(kb *internal.KnowledgeBase) *researchTools {
+	return &researchTools{
+		pages: internal.NewPageStore(2000),
+		kb:    kb,
+		board: &blackboard{},
+	}
+}
+
+// start prepares the tools for a query, with the blackboard of the checkpoint it resumes from
+func (t *researchTools) start(from *workflowCheckpoint, checkpoints *runCheckpoints) {
+	var board *blackboardState
+	if from != nil {
+		board = from.State.Blackboard
+	}
+	t.board.reset(board)
+
+	t.checkpoints = checkpoints
+	checkpoints.track(t.board)
+}
+
+// Tool to search our own documents
+func (t *researchTools) knowledgeSearch(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+	query, ok := args["query"].(string)
+	if !ok {
+		return swarmgo.Result{
+			Data: "Error: query parameter is required and must be a string",
+			Success: false,
+		}
+	}
+
+	hits, err := t.kb.Search(context.Background(), query, 3)
+	if err != nil {
+		return swarmgo.Result{
+			Error: fmt.Errorf("failed to search knowledge base: %w", err),
+			Success: false,
+		}
+	}
+
+	return swarmgo.Result{
+		Data: internal.FormatHits(hits),
+		Success: true,
+	}
+}
+
+// Tool to scrape content from a URL
+func (t *researchTools) scrapeUrl(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+	url, ok := args["url"].(string)
+	if !ok {
+		return swarmgo.Result{
+			Data: "Error: url parameter is required and must be a string",
+			Success: false,
+		}
+	}
+
+	url = strings.ReplaceAll(url, `"`, "")
+	scraperClient := internal.NewScraperClient()
+	page, err := t.pages.Scrape(scraperClient, url)
+	if err != nil {
+		return swarmgo.Result{
+			Error: fmt.Errorf("failed to scrape URL: %w", err),
+			Success: false,
+		}
+	}
+
+	source := t.board.addSource(blackboardSource{URL: page.URL, Title: page.Title, Page: page.ID, Fetched: page.Fetched, Hash: page.Hash})
+
+	return swarmgo.Result{
+		Data: fmt.Sprintf("Source %s, cite it as [%s].\n%s", source, source, page.Overview(500)),
+		Success: true,
+	}
+}
+
+// Tool to read a chunk of a scraped page
+func (t *researchTools) readChunk(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+	id, ok := args["id"].(string)
+	if !ok {
+		return swarmgo.Result{
+			Data: "Error: id parameter is required and must be a string",
+			Success: false,
+		}
+	}
+
+	chunk, ok := t.pages.Chunk(id)
+	if !ok {
+		return swarmgo.Result{
+			Data: fmt.Sprintf("Error: unknown chunk %s", id),
+			Success: false,
+		}
+	}
+
+	return swarmgo.Result{
+		Data: chunk.Text,
+		Success: true,
+	}
+}
+
+// Tool to find the chunks of a scraped page matching a query
+func (t *researchTools) findInPage(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+	pageID, ok := args["page_id"].(string)
+	if !ok {
+		return swarmgo.Result{
+			Data: "Error: page_id parameter is required and must be a string",
+			Success: false,
+		}
+	}
+
+	query, ok := args["query"].(string)
+	if !ok {
+		return swarmgo.Result{
+			Data: "Error: query parameter is required and must be a string",
+			Success: false,
+		}
+	}
+
+	chunks, err := t.pages.Find(pageID, query, 3)
+	if err != nil {
+		return swarmgo.Result{
+			Data: fmt.Sprintf("Error searching page: %v", err),
+			Success: false,
+		}
+	}
+
+	return swarmgo.Result{
+		Data: internal.FormatChunks(chunks),
+		Success: true,
+	}
+}
+
+// Tool to manage files
+func manageFiles(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+	action, ok := args["action"].(string)
+	if !ok {
+		return swarmgo.Result{
+			Data: "Error: action parameter is required and must be a string (read, write, or list)",
+			Success: false,
+		}
+	}
+
+	path, ok := args["path"].(string)
+	if !ok {
+		return swarmgo.Result{
+			Data: "Error: path parameter is required and must be a string",
+			Success: false,
+		}
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return swarmgo.Result{
+			Data: fmt.Sprintf("Error getting current directory: %v", err),
+			Success: false,
+		}
+	}
+	path = filepath.Join(dir, path)
+
+	switch action {
+	case "read":
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return swarmgo.Result{
+				Data: fmt.Sprintf("Error reading file: %v", err),
+				Success: false,
+			}
+		}
+		return swarmgo.Result{
+			Data: string(content),
+			Success: true,
+		}
+	case "write":
+		content, ok := args["content"].(string)
+		if !ok {
+			return swarmgo.Result{
+				Data: "Error: content parameter is required for write operation",
+				Success: false,
+			}
+		}
+		dir := filepath.Dir(path)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			os.MkdirAll(dir, 0755)
+		}
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			return swarmgo.Result{
+				Data: fmt.Sprintf("Error writing file: %v", err),
+				Success: false,
+			}
+		}
+		return swarmgo.Result{
+			Data: fmt.Sprintf("File %s written successfully", path),
+			Success: true,
+		}
+	case "list":
+		files, err := os.ReadDir(path)
+		if err != nil {
+			return swarmgo.Result{
+				Data: fmt.Sprintf("Error listing directory: %v", err),
+				Success: false,
+			}
+		}
+		var result strings.Builder
+		for _, file := range files {
+			result.WriteString(file.Name() + "\n")
+		}
+		return swarmgo.Result{
+			Data: result.String(),
+			Success: true,
+		}
+	default:
+		return swarmgo.Result{
+			Data: fmt.Sprintf("Unknown action: %s. Must be read, write, or list", action),
+			Success: false,
+		}
+	}
+}
+
+// Tool to get human input
+func getHumanInput(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+	question, ok := args["question"].(string)
+	if !ok {
+		return swarmgo.Result{
+			Data: "Error: question parameter is required",
+			Success: false,
+		}
+	}
+
+	// The question goes to stderr, as stdout may carry JSON results
+	fmt.Fprintf(os.Stderr, "\n🧠 Human input needed: %s\n", question)
+	fmt.Fprint(os.Stderr, "Your response: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+
+	return swarmgo.Result{
+		Data: response,
+		Success: true,
+	}
+}
+
+// Tool to get human input, checkpointing the question so a run stopped while waiting asks it again on resume
+func (t *researchTools) askHuman(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+	question, _ := args["question"].(string)
+	if question != "" {
+		t.checkpoints.ask(question)
+	}
+
+	result := getHumanInput(args, contextVariables)
+	if result.Success {
+		t.checkpoints.answered(question, fmt.Sprint(result.Data))
+	}
+	return result
+}
+
+// trackTool wraps a tool function so every call is recorded for the agent currently running
+// and traced as a span of the query being executed
+func trackTool(run *workflowRun, name string, fn func(map[string]interface{}, map[string]interface{}) swarmgo.Result) func(map[string]interface{}, map[string]interface{}) swarmgo.Result {
+	return func(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+		agent := run.workflow.GetCurrentAgent()
+		_, span := internal.StartSpan(run.ctx, internal.SpanTool, name)
+		input, _ := json.Marshal(args)
+		span.Input = string(input)
+		span.SetAttribute("agent", agent)
+
+		result := fn(args, contextVariables)
+
+		run.tracker.RecordTool(agent, name, time.Since(span.Start))
+		span.Output = fmt.Sprint(result.Data)
+
+		var err error
+		if result.Error != nil {
+			// Recoverable errors are shown to the agent by swarmgo, fatal ones end the run
+			// once the workflow returns, since swarmgo can't be stopped from a tool
+			toolErr := internal.NewToolError(name, result.Error)
+			if toolErr.Fatal {
+				run.fail(toolErr)
+			}
+			err = toolErr
+		} else if !result.Success {
+			span.Error = "tool call failed"
+		}
+		span.Finish(err)
+
+		return result
+	}
+}
+
+// defaultPrompt is the user request used when no query is given
+const defaultPrompt = "I need a comprehensive report on something that is happening in the world. You can ask human for any clarifications."
+
+// functionNames returns the names of the functions
+func functionNames(functions []swarmgo.AgentFunction) []string {
+	names := make([]string, len(functions))
+	for i, function := range functions {
+		names[i] = function.Name
+	}
+	return names
+}
+
+// enabledFunctions drops the functions that aren't enabled in the run options
+func enabledFunctions(options internal.RunOptions, functions []swarmgo.AgentFunction) []swarmgo.AgentFunction {
+	var enabled []swarmgo.AgentFunction
+	for _, function := range functions {
+		if options.ToolEnabled(function.Name) {
+			enabled = append(enabled, function)
+		}
+	}
+	return enabled
+}
+
+// tools are the functions agents can be given in a workflow definition, see toolHandlers for their handlers
+var tools = []swarmgo.AgentFunction{
+	{
+		Name:        "getHumanInput",
+		Description: "Ask a human for input",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"question": map[string]interface{}{
+					"type":        "string",
+					"description": "The question to ask the human",
+				},
+			},
+			"required": []string{"question"},
+		},
+	},
+	{
+		Name:        "manageFiles",
+		Description: "Read, write, and list files",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"action": map[string]interface{}{
+					"type":        "string",
+					"description": "The action to perform: read, write, list or mkdir",
+					"enum":        []string{"read", "write", "list", "mkdir"},
+				},
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The file or directory path",
+				},
+				"content": map[string]interface{}{
+					"type":        "string",
+					"description": "Content to write (only for write action)",
+				},
+			},
+			"required": []string{"action", "path"},
+		},
+	},
+	{
+		Name:        "searchWeb",
+		Description: "Search the web and return the json with the urls of search results",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "The search query",
+				},
+			},
+			"required": []string{"query"},
+		},
+	},
+	{
+		Name:        "scrapeUrl",
+		Description: "Fetch the content of a URL",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"url": map[string]interface{}{
+					"type":        "string",
+					"description": "The URL to scrape",
+				},
+			},
+			"required": []string{"url"},
+		},
+	},
+	{
+		Name:        "readChunk",
+		Description: "Read a chunk of a scraped page by its id",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"id": map[string]interface{}{
+					"type":        "string",
+					"description": "The chunk id, e.g. p1#2",
+				},
+			},
+			"required": []string{"id"},
+		},
+	},
+	{
+		Name:        "findInPage",
+		Description: "Find the chunks of a scraped page containing the most of the keywords. Only exact words match, not synonyms or other forms",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"page_id": map[string]interface{}{
+					"type":        "string",
+					"description": "The page id returned by scrapeUrl, e.g. p1",
+				},
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "Keywords to look for, matched as whole words ignoring case",
+				},
+			},
+			"required": []string{"page_id", "query"},
+		},
+	},
+	{
+		Name:        fanOutTool,
+		Description: "Research several independent subtasks at once, each by its own researcher, and get their merged findings",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"tasks": map[string]interface{}{
+					"type":        "array",
+					"description": "The subtasks, each with everything a researcher needs to know to do it",
+					"items": map[string]interface{}{
+						"type": "string",
+					},
+				},
+			},
+			"required": []string{"tasks"},
+		},
+	},
+	{
+		Name:        "writeBlackboard",
+		Description: "Add to the blackboard shared by all agents: a fact with the url it came from, a source, a draft report section, an open question or the answer to one",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"kind": map[string]interface{}{
+					"type":        "string",
+					"description": "What to add",
+					"enum":        []string{"fact", "source", "section", "question", "answer"},
+				},
+				"text": map[string]interface{}{
+					"type":        "string",
+					"description": "The fact, section text, question or answer",
+				},
+				"url": map[string]interface{}{
+					"type":        "string",
+					"description": "The URL of a source or of the source of a fact",
+				},
+				"title": map[string]interface{}{
+					"type":        "string",
+					"description": "The title of a section or source",
+				},
+				"id": map[string]interface{}{
+					"type":        "string",
+					"description": "The id of the question answered, e.g. q1",
+				},
+			},
+			"required": []string{"kind"},
+		},
+	},
+	{
+		Name:        reviewTool,
+		Description: "Submit your review of the writer's draft: approve it, or request a revision listing the claims the sources don't support or contradict",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"verdict": map[string]interface{}{
+					"type":        "string",
+					"description": "approve if every claim is supported by its sources, otherwise revise",
+					"enum":        []string{verdictApprove, verdictRevise},
+				},
+				"summary": map[string]interface{}{
+					"type":        "string",
+					"description": "A short summary of the review",
+				},
+				"issues": map[string]interface{}{
+					"type":        "array",
+					"description": "The claims to fix",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"claim": map[string]interface{}{
+								"type":        "string",
+								"description": "The claim as written in the draft",
+							},
+							"problem": map[string]interface{}{
+								"type":        "string",
+								"description": "unsupported if no source backs the claim, contradicted if a source says otherwise",
+								"enum":        reviewProblems,
+							},
+							"source": map[string]interface{}{
+								"type":        "string",
+								"description": "The id of the source cited by or contradicting the claim, e.g. s1",
+							},
+							"fix": map[string]interface{}{
+								"type":        "string",
+								"description": "How the writer should fix the claim",
+							},
+						},
+						"required": []string{"claim", "problem"},
+					},
+				},
+			},
+			"required": []string{"verdict"},
+		},
+	},
+	{
+		Name:        "readBlackboard",
+		Description: "Read everything on the blackboard shared by all agents: facts, sources, draft sections and questions",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	},
+	{
+		Name:        "knowledgeSearch",
+		Description: "Search our own documents and return the most relevant passages",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "What to look for",
+				},
+			},
+			"required": []string{"query"},
+		},
+	},
+}
+
+// findTool returns the registered tool with the given name
+func findTool(name string) (swarmgo.AgentFunction, bool) {
+	for _, tool := range tools {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	return swarmgo.AgentFunction{}, false
+}
+
+// toolNames returns the names of all registered tools
+func toolNames() []string {
+	return functionNames(tools)
+}
+
+// toolHandlers returns the handlers of the registered tools by name
+func toolHandlers(research *researchTools) map[string]func(map[string]interface{}, map[string]interface{}) swarmgo.Result {
+	handlers := map[string]func(map[string]interface{}, map[string]interface{}) swarmgo.Result{
+		"getHumanInput":   research.askHuman,
+		"searchWeb":       searchWeb,
+		"scrapeUrl":       research.scrapeUrl,
+		"readChunk":       research.readChunk,
+		"findInPage":      research.findInPage,
+		"knowledgeSearch": research.knowledgeSearch,
+		"readBlackboard":  research.readBlackboard,
+	}
+	for name, handler := range contextHandlers(research) {
+		handlers[name] = func(args map[string]interface{}, contextVariables map[string]interface{}) swarmgo.Result {
+			ctx := research.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			return handler(ctx, args)
+		}
+	}
+	return handlers
+}
+
+// contextHandlers returns the handlers of the registered tools that trace what they do in a context
+func contextHandlers(research *researchTools) map[string]func(context.Context, map[string]interface{}) swarmgo.Result {
+	return map[string]func(context.Context, map[string]interface{}) swarmgo.Result{
+		fanOutTool:        research.dispatch,
+		"writeBlackboard": research.writeBlackboard,
+		"manageFiles":     research.manageFiles,
+		reviewTool:        research.submitReview,
+	}
+}
+
+// bindTools returns the registered tools by name with their handlers, tracked in run
+func bindTools(run *workflowRun, research *researchTools) map[string]swarmgo.AgentFunction {
+	handlers := toolHandlers(research)
+
+	bound := make(map[string]swarmgo.AgentFunction, len(tools))
+	for _, tool := range tools {
+		tool.Function = trackTool(run, tool.Name, handlers[tool.Name])
+		bound[tool.Name] = tool
+	}
+	return bound
+}
+
+// baseTransport is the HTTP transport model calls go through before usage tracking is added
+var baseTransport = http.DefaultTransport
+
+// transportMu serializes swarmgo queries, which track usage by swapping http.DefaultTransport
+var transportMu sync.Mutex
+
+// workflowRun is the workflow with the usage tracking and tracing of its queries
+type workflowRun struct {
+	workflow  *swarmgo.Workflow
+	start     string
+	tracker   *internal.UsageTracker
+	transport *internal.UsageTransport
+	// ctx is the span context of the query being executed, swarmgo doesn't pass one to tools
+	ctx context.Context
+	// fatal is the first fatal tool error of the query being executed
+	fatal error
+	// prompts are the agents' instruction prompts, recorded in the trace
+	prompts  []*internal.Prompt
+	research *researchTools
+
+	// checkpoints of the query being executed, with its state after step
+	checkpoints *runCheckpoints
+	state       graphState
+	step        int
+	// saved counts the swarmgo steps checkpointed so far
+	saved int
+	// cycles counts the agent revisits of the query being executed
+	cycles int
+}
+
+// fail records a fatal tool error, keeping the first one
+func (r *workflowRun) fail(err error) {
+	if r.fatal == nil {
+		r.fatal = err
+	}
+}
+
+// newWorkflow creates the workflow of the definition, recording usage in tracker
+func newWorkflow(definition *workflowDefinition, library *internal.PromptLibrary, tracker *internal.UsageTracker, kb *internal.KnowledgeBase, options internal.RunOptions) (*workflowRun, error) {
+	workflow := swarmgo.NewWorkflow(os.Getenv("OPENAI_API_KEY"), llm.OpenAI, workflowTypes[definition.Type])
+	workflow.SetCycleHandling(swarmgo.ContinueOnCycle)
+
+	// swarmgo doesn't expose model responses or finished steps, so usage is read from the default
+	// HTTP transport while a query is executed and attributed to the agent and step being executed,
+	// and the steps finished before each request are checkpointed
+	var run *workflowRun
+	transport := internal.NewUsageTransport(baseTransport, tracker, func() (string, int) {
+		run.saveSteps()
+		return workflow.GetCurrentAgent(), len(workflow.GetAllStepResults()) + 1
+	})
+
+	run = &workflowRun{
+		workflow:  workflow,
+		start:     definition.Start,
+		tracker:   tracker,
+		transport: transport,
+		ctx:       context.Background(),
+		research:  newResearchTools(kb),
+	}
+
+	// Every revisit of an agent is a cycle, stop once the iteration limit of the query is reached
+	workflow.SetCycleCallback(func(from, to string) (bool, error) {
+		run.cycles++
+		return options.MaxIter <= 0 || run.cycles <= options.MaxIter, nil
+	})
+
+	prompts, err := definition.build(workflow, library, bindTools(run, run.research), run.research.board, options)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+	run.prompts = prompts
+
+	if definition.FanOut != nil {
+		agents, _, err := definition.nativeAgents(library, nativeTools(run.research), run.research.board, options)
+		if err != nil {
+			return nil, err
+		}
+		run.research.fanOut = definition.newFanOut(agents, tracker)
+	}
+	run.research.maxRevisions = definition.maxRevisions()
+
+	return run, nil
+}
+
+// run answers a query with swarmgo. A resumed query starts over at the next agent with the work so far,
+// as swarmgo can't continue a run.
+func (r *workflowRun) run(ctx context.Context, query string, from *workflowCheckpoint, checkpoints *runCheckpoints) (*workflowOutput, error) {
+	start, request := r.start, query
+	r.state, r.step, r.cycles = graphState{Query: query}, 0, 0
+	if from != nil {
+		request = from.State.task()
+		r.state, r.step = from.State, from.Step
+		if len(from.Next) > 0 {
+			start = from.Next[0]
+		}
+	}
+	r.checkpoints = checkpoints
+	r.research.start(from, checkpoints)
+	r.saved = len(r.workflow.GetAllStepResults())
+
+	result, err := r.execute(ctx, start, request)
+	r.saveSteps()
+	if err == nil {
+		r.checkpoints.saveLogged(workflowCheckpoint{Step: r.step, State: r.state})
+	}
+	if result == nil {
+		return nil, err
+	}
+	answer, _ := r.research.cite(r.ctx, finalAnswer(*result))
+
+	return &workflowOutput{
+		answer: answer,
+		steps:  len(result.Steps),
+		print: func(w io.Writer, usage internal.UsageReport) {
+			printWorkflowSummary(w, *result, usage)
+			for _, step := range result.Steps {
+				printStepResult(w, step)
+			}
+		},
+	}, err
+}
+
+// saveSteps checkpoints the steps swarmgo finished since the last call
+func (r *workflowRun) saveSteps() {
+	steps := r.workflow.GetAllStepResults()
+	for ; r.saved < len(steps); r.saved++ {
+		step := steps[r.saved]
+
+		var answer string
+		for _, msg := range step.Output {
+			if msg.Role == llm.RoleAssistant && msg.Content != "" {
+				answer = msg.Content
+			}
+		}
+
+		r.step++
+		r.state = r.state.addOutput(step.AgentName, answer)
+
+		checkpoint := workflowCheckpoint{Step: r.step, State: r.state}
+		if step.NextAgent != "" {
+			checkpoint.Next = []string{step.NextAgent}
+		}
+		r.checkpoints.saveLogged(checkpoint)
+	}
+}
+
+// execute runs the workflow for a query from the start agent, tracing it as a run with a span per agent step and handoff
+func (r *workflowRun) execute(ctx context.Context, start, query string) (result *swarmgo.WorkflowResult, err error) {
+	ctx, span := internal.StartSpan(ctx, internal.SpanRun, "swarm")
+	span.Input = query
+	span.SetAttribute("prompt", internal.PromptIDs(r.prompts...))
+	defer func() {
+		if result != nil {
+			span.Output = finalAnswer(*result)
+			span.SetAttribute("steps", len(result.Steps))
+		}
+		span.Finish(err)
+	}()
+
+	r.ctx = ctx
+	r.research.ctx = ctx
+	r.fatal = nil
+	r.transport.SetSpanContext(ctx)
+
+	// swarmgo's OpenAI client can't be given an HTTP client, so its requests are tracked by
+	// swapping the default transport for the query only, and calls after it aren't counted
+	transportMu.Lock()
+	previous := http.DefaultTransport
+	http.DefaultTransport = r.transport
+	defer func() {
+		http.DefaultTransport = previous
+		transportMu.Unlock()
+	}()
+
+	result, err = r.workflow.Execute(start, query)
+	if result != nil {
+		traceSteps(ctx, result.Steps)
+	}
+
+	return result, errors.Join(r.fatal, err)
+}
+
+// traceSteps records the agent steps and handoffs of a finished workflow, swarmgo only reports them afterwards
+func traceSteps(ctx context.Context, steps []swarmgo.StepResult) {
+	for _, step := range steps {
+		_, span := internal.StartSpanAt(ctx, internal.SpanAgent, step.AgentName, step.StartTime)
+		if len(step.Input) > 0 {
+			span.Input = step.Input[len(step.Input)-1].Content
+		}
+		for _, msg := range step.Output {
+			if msg.Role == llm.RoleAssistant && msg.Content != "" {
+				span.Output = msg.Content
+			}
+		}
+		span.SetAttribute("step", step.StepNumber)
+		span.FinishAt(step.EndTime, step.Error)
+
+		if step.NextAgent != "" {
+			_, handoff := internal.StartSpanAt(ctx, internal.SpanHandoff, step.AgentName+" -> "+step.NextAgent, step.EndTime)
+			handoff.SetAttribute("from", step.AgentName)
+			handoff.SetAttribute("to", step.NextAgent)
+			handoff.FinishAt(step.EndTime, nil)
+		}
+	}
+}
+
+// workflowRunner answers queries with one of the engines
+type workflowRunner interface {
+	// run answers a query, continuing from the checkpoint if there is one, and saves a checkpoint after every step
+	run(ctx context.Context, query string, from *workflowCheckpoint, checkpoints *runCheckpoints) (*workflowOutput, error)
+}
+
+// workflowOutput is the outcome of a query
+type workflowOutput struct {
+	answer string
+	steps  int
+	// print shows the steps in detail
+	print func(w io.Writer, usage internal.UsageReport)
+}
+
+// newRunner creates the workflow of the definition with its engine
+func newRunner(definition *workflowDefinition, library *internal.PromptLibrary, tracker *internal.UsageTracker, kb *internal.KnowledgeBase, options internal.RunOptions) (workflowRunner, error) {
+	if definition.native() {
+		workflow, err := newNativeWorkflow(definition, library, tracker, kb, options)
+		if err != nil {
+			return nil, err
+		}
+		return workflow, nil
+	}
+
+	workflow, err := newWorkflow(definition, library, tracker, kb, options)
+	if err != nil {
+		return nil, err
+	}
+	return workflow, nil
+}
+
+// Run executes the report workflow for every query, checkpointing each query as a run to resume
+func Run(ctx context.Context, options internal.RunOptions) error {
+	if options.Interactive {
+		return fmt.Errorf("interactive mode is not supported by the multi-agent workflow")
+	}
+	internal.LoadEnv()
+
+	tracker, err := internal.NewUsageTrackerFromEnv()
+	if err != nil {
+		return fmt.Errorf("error loading price table: %w", err)
+	}
+
+	kb, err := internal.OpenKnowledgeBaseFromEnv(ctx, tracker)
+	if err != nil {
+		return fmt.Errorf("error opening knowledge base: %w", err)
+	}
+
+	library, err := internal.LoadPrompts()
+	if err != nil {
+		return err
+	}
+	definition, err := loadWorkflowDefinition(library)
+	if err != nil {
+		return err
+	}
+
+	if !definition.native() && options.Temperature != nil {
+		internal.Logger("agent").Warn("swarmgo doesn't support setting the temperature, ignoring it")
+	}
+
+	runner, err := newRunner(definition, library, tracker, kb, options)
+	if err != nil {
+		return err
+	}
+
+	store := checkpointStoreFromEnv()
+	for _, userPrompt := range options.QueriesOr(defaultPrompt) {
+		checkpoints, err := store.create(runRecord{Query: userPrompt, Definition: definition, Options: options})
+		if err != nil {
+			return err
+		}
+		checkpoints.saveLogged(workflowCheckpoint{State: graphState{Query: userPrompt}, Next: []string{definition.Start}})
+
+		runQuery(ctx, runner, userPrompt, nil, checkpoints, tracker, options)
+		checkpoints.close()
+	}
+
+	return finishRun(tracker, options)
+}
+
+// runQuery answers a query, or continues it from a checkpoint, and prints the result to stdout and
+// the steps to the console
+func runQuery(ctx context.Context, runner workflowRunner, query string, from *workflowCheckpoint, checkpoints *runCheckpoints, tracker *internal.UsageTracker, options internal.RunOptions) {
+	console := options.Console()
+	printWorkflowStart(console)
+
+	runResult := internal.RunResult{Query: query}
+	output, err := runner.run(ctx, query, from, checkpoints)
+	if err != nil {
+		runResult.Error = err.Error()
+	}
+
+	if output != nil {
+		output.print(console, tracker.Report())
+		runResult.Answer = output.answer
+	}
+
+	internal.PrintResult(os.Stdout, options.Output, runResult)
+}
+
+// finishRun prints and writes the usage of all queries
+func finishRun(tracker *internal.UsageTracker, options internal.RunOptions) error {
+	tracker.PrintSummary(options.Console())
+	if err := tracker.WriteReport("usage_report.json"); err != nil {
+		return fmt.Errorf("error writing usage report: %w", err)
+	}
+
+	return nil
+}
+
+// finalAnswer returns the content of the last assistant message of the workflow
+func finalAnswer(result swarmgo.WorkflowResult) string {
+	for i := len(result.FinalOutput) - 1; i >= 0; i-- {
+		msg := result.FinalOutput[i]
+		if msg.Role == llm.RoleAssistant && msg.Content != "" {
+			return msg.Content
+		}
+	}
+	return ""
+}
+
+
+//
+// PRINT UTILS
+//
+func printOutputs(w io.Writer, output []llm.Message) {
+	for _, msg := range output {
+		switch msg.Role {
+		case llm.RoleUser:
+			fmt.Fprintf(w, "\033[92m[User]\033[0m: %s\n", msg.Content)
+		case llm.RoleAssistant:
+			name := msg.Name
+			if name == "" {
+				name = "Assistant"
+			}
+			fmt.Fprintf(w, "\033[94m[%s]\033[0m: %s\n", name, msg.Content)
+		case llm.RoleFunction, "tool":
+			fmt.Fprintf(w, "\033[95m[Function Result]\033[0m: %s\n", msg.Content)
+		}
+	}
+}
+
+
+func printStepResult(w io.Writer, step swarmgo.StepResult) {
+	fmt.Fprintln(w, "\n\033[96mDetailed Step Results\033[0m")
+
+	fmt.Fprintf(w, "\n\033[95mStep %d Results:\033[0m\n", step.StepNumber)
+	fmt.Fprintf(w, "Agent: %s\n", step.AgentName)
+	fmt.Fprintf(w, "Duration: %v\n", step.EndTime.Sub(step.StartTime))
+	if step.Error != nil {
+		fmt.Fprintf(w, "\033[91mError: %v\033[0m\n", step.Error)
+		return
+	}
+
+	fmt.Fprintln(w, "Output:")
+	printOutputs(w, step.Output)
+
+	if step.NextAgent != "" {
+		fmt.Fprintf(w, "\nNext Agent: %s\n", step.NextAgent)
+	}
+	fmt.Fprintln(w, "-----------------------------------------")
+}
+
+func printWorkflowSummary(w io.Writer, result swarmgo.WorkflowResult, usage internal.UsageReport) {
+	fmt.Fprintf(w, "\n\033[96mWorkflow Summary\033[0m\n")
+	fmt.Fprintf(w, "Total Duration: %v\n", result.EndTime.Sub(result.StartTime))
+	fmt.Fprintf(w, "Total Steps: %d\n", len(result.Steps))
+	fmt.Fprintf(w, "Total Tokens: %d\n", usage.Total.Usage.PromptTokens+usage.Total.Usage.CompletionTokens)
+	fmt.Fprintf(w, "Total Cost: $%.4f\n", usage.Total.Cost)
+}
+
+func printWorkflowStart(w io.Writer) {
+	fmt.Fprintln(w, "\n\033[96mStarting Report Generation Workflow\033[0m")
+	fmt.Fprintln(w, "================================")
+}
+
+// NewAnswerer returns an answerer running every query in a fresh workflow.
+// Queries are run one at a time, as usage is tracked through the shared default transport.
+func NewAnswerer(ctx context.Context, options internal.RunOptions) (internal.Answerer, error) {
+	internal.LoadEnv()
+
+	tracker, err := internal.NewUsageTrackerFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("error loading price table: %w", err)
+	}
+
+	kb, err := internal.OpenKnowledgeBaseFromEnv(ctx, tracker)
+	if err != nil {
+		return nil, fmt.Errorf("error opening knowledge base: %w", err)
+	}
+
+	library, err := internal.LoadPrompts()
+	if err != nil {
+		return nil, err
+	}
+	definition, err := loadWorkflowDefinition(library)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	return func(ctx context.Context, query string) (internal.Answer, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		queryTracker := tracker.Fork()
+		runner, err := newRunner(definition, library, queryTracker, kb, options)
+		if err != nil {
+			return internal.Answer{}, err
+		}
+
+		var answer internal.Answer
+		output, err := runner.run(ctx, query, nil, nil)
+		if output != nil {
+			answer.Text = output.answer
+			answer.Steps = output.steps
+		}
+		answer.Usage = queryTracker.Report().Total
+
+		return answer, err
+	}, nil
+}
@@ -0,0 +1,413 @@
+// Package orchestrator runs multi-agent systems on top of internal.ChatModel without a framework.
+// A Supervisor's lead agent delegates tasks to its workers through explicit handoffs, a Pipeline
+// passes a task through its stages in order, and a Supervisor whose workers are Supervisors
+// forms a hierarchy of teams. FanOut runs independent tasks concurrently, each in a run of its own.
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+)
+
+var (
+	// ErrStepLimit ends a run that used up Options.MaxSteps
+	ErrStepLimit = errors.New("step limit reached")
+	// ErrCycle ends a run with CycleFail when a handoff repeats or an agent is visited too often
+	ErrCycle = errors.New("handoff cycle detected")
+)
+
+// defaultMaxToolRounds is the number of model calls an agent turn may take if not configured
+const defaultMaxToolRounds = 10
+
+// CyclePolicy decides what happens when a handoff repeats an earlier one or exceeds Options.MaxVisits
+type CyclePolicy int
+
+const (
+	// CycleAllow lets the handoff through, only the step limit ends the run
+	CycleAllow CyclePolicy = iota
+	// CycleReject refuses the handoff and tells the delegating agent to do something else
+	CycleReject
+	// CycleFail ends the run with ErrCycle
+	CycleFail
+)
+
+// ParseCyclePolicy parses allow, reject or fail
+func ParseCyclePolicy(name string) (CyclePolicy, error) {
+	switch name {
+	case "", "allow":
+		return CycleAllow, nil
+	case "reject":
+		return CycleReject, nil
+	case "fail":
+		return CycleFail, nil
+	}
+	return CycleAllow, fmt.Errorf("unknown cycle policy %q, expected allow, reject or fail", name)
+}
+
+// Options configures the runs of an engine
+type Options struct {
+	// MaxSteps limits the agent turns of a run, 0 means no limit
+	MaxSteps int
+	// MaxToolRounds limits the model calls of a single agent turn
+	MaxToolRounds int
+	// MaxVisits limits how often the same agent may be handed a task, 0 means no limit
+	MaxVisits   int
+	CyclePolicy CyclePolicy
+	// CheckHandoff may refuse a handoff, the delegating agent is told the error
+	CheckHandoff func(from, to string) error
+	Temperature  *float64
+	// OnStep is called after every agent turn, e.g. to checkpoint the run
+	OnStep func(step Step)
+}
+
+// Tool is a function an agent may call, with access to the run's shared state
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments
+	Parameters map[string]any
+	Run        func(ctx context.Context, state *State, args map[string]any) (string, error)
+}
+
+// Node handles a task: an Agent, a Pipeline or a Supervisor
+type Node interface {
+	// describe returns the name and description shown to a delegating agent
+	describe() (name, description string)
+	handle(ctx context.Context, r *run, task string) (string, error)
+}
+
+// Handoff passes a task, or the result of one, from an agent to another
+type Handoff struct {
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Step is a turn of an agent working on a task
+type Step struct {
+	Number int       `json:"number"`
+	Agent  string    `json:"agent"`
+	Task   string    `json:"task"`
+	Output string    `json:"output"`
+	Error  string    `json:"error,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// Result is the outcome of a run
+type Result struct {
+	Output string
+	Steps  []Step
+	State  *State
+}
+
+// State is shared by all agents of a run. Values are shown to every agent and readable by tools.
+type State struct {
+	mu       sync.Mutex
+	values   map[string]any
+	handoffs []Handoff
+}
+
+// NewState creates an empty state
+func NewState() *State {
+	return &State{values: make(map[string]any)}
+}
+
+// Get returns a value
+func (s *State) Get(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.values[key]
+	return value, ok
+}
+
+// Set stores a value
+func (s *State) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = value
+}
+
+// Values returns a copy of all values
+func (s *State) Values() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := make(map[string]any, len(s.values))
+	for key, value := range s.values {
+		values[key] = value
+	}
+	return values
+}
+
+// Handoffs returns the handoffs of the run so far
+func (s *State) Handoffs() []Handoff {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Handoff(nil), s.handoffs...)
+}
+
+func (s *State) addHandoff(handoff Handoff) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handoffs = append(s.handoffs, handoff)
+}
+
+// Engine runs nodes with a chat model
+type Engine struct {
+	model   internal.ChatModel
+	tracker *internal.UsageTracker
+	options Options
+}
+
+// New creates an engine recording tool calls in tracker
+func New(model internal.ChatModel, tracker *internal.UsageTracker, options Options) *Engine {
+	if options.MaxToolRounds <= 0 {
+		options.MaxToolRounds = defaultMaxToolRounds
+	}
+	return &Engine{model: model, tracker: tracker, options: options}
+}
+
+// Run hands the input to root and returns its output. Without a state a new one is used.
+// The steps taken so far are returned along with any error.
+func (e *Engine) Run(ctx context.Context, root Node, input string, state *State) (*Result, error) {
+	if state == nil {
+		state = NewState()
+	}
+
+	r := &run{
+		engine: e,
+		state:  state,
+		visits: make(map[string]int),
+		seen:   make(map[string]bool),
+	}
+
+	output, err := r.handoff(ctx, "user", root, input)
+	return &Result{Output: output, Steps: r.steps, State: state}, err
+}
+
+// run is the bookkeeping of a single Engine.Run
+type run struct {
+	engine *Engine
+	state  *State
+	steps  []Step
+	// visits counts the tasks handed to each node
+	visits map[string]int
+	// seen holds every handoff so far, to detect cycles
+	seen map[string]bool
+}
+
+// handoff passes a task from an agent to a node, applying the cycle policy, and returns the node's output
+func (r *run) handoff(ctx context.Context, from string, to Node, message string) (string, error) {
+	name, _ := to.describe()
+
+	key := from + "\x00" + name + "\x00" + strings.Join(strings.Fields(strings.ToLower(message)), " ")
+	cycle := r.seen[key] || (r.engine.options.MaxVisits > 0 && r.visits[name] >= r.engine.options.MaxVisits)
+	if cycle {
+		internal.Logger("orchestrator").Warn("handoff cycle detected", "from", from, "to", name)
+		switch r.engine.options.CyclePolicy {
+		case CycleReject:
+			return fmt.Sprintf("Handoff refused: %s already got this task or too many tasks. Use the results you have or try something else.", name), nil
+		case CycleFail:
+			return "", &internal.ToolError{Tool: "transfer_to_" + name, Fatal: true, Err: fmt.Errorf("%w: %s -> %s", ErrCycle, from, name)}
+		}
+	}
+	if check := r.engine.options.CheckHandoff; check != nil {
+		if err := check(from, name); err != nil {
+			internal.Logger("orchestrator").Warn("handoff refused", "from", from, "to", name, "error", err)
+			return fmt.Sprintf("Handoff refused: %v", err), nil
+		}
+	}
+	r.seen[key] = true
+	r.visits[name]++
+
+	r.recordHandoff(ctx, Handoff{From: from, To: name, Message: message, Time: time.Now()})
+	output, err := to.handle(ctx, r, message)
+	if err != nil {
+		return output, err
+	}
+	r.recordHandoff(ctx, Handoff{From: name, To: from, Message: output, Time: time.Now()})
+
+	return output, nil
+}
+
+func (r *run) recordHandoff(ctx context.Context, handoff Handoff) {
+	r.state.addHandoff(handoff)
+
+	_, span := internal.StartSpanAt(ctx, internal.SpanHandoff, handoff.From+" -> "+handoff.To, handoff.Time)
+	span.Input = handoff.Message
+	span.SetAttribute("from", handoff.From)
+	span.SetAttribute("to", handoff.To)
+	span.FinishAt(handoff.Time, nil)
+}
+
+// beginStep starts a turn of an agent and returns its number, or fails once the step limit is reached
+func (r *run) beginStep(agent, task string) (int, error) {
+	if max := r.engine.options.MaxSteps; max > 0 && len(r.steps) >= max {
+		return 0, &internal.ToolError{Tool: agent, Fatal: true, Err: fmt.Errorf("%w: %d steps", ErrStepLimit, max)}
+	}
+
+	r.steps = append(r.steps, Step{Number: len(r.steps) + 1, Agent: agent, Task: task, Start: time.Now()})
+	return len(r.steps), nil
+}
+
+// Agent is a model with instructions and its own tool set
+type Agent struct {
+	Name string
+	// Description tells delegating agents what this agent is for
+	Description  string
+	Model        string
+	Instructions string
+	// Briefing returns more instructions on every turn, e.g. state kept outside the run
+	Briefing func() string
+	Tools    []Tool
+}
+
+func (a *Agent) describe() (string, string) {
+	return a.Name, a.Description
+}
+
+func (a *Agent) handle(ctx context.Context, r *run, task string) (string, error) {
+	return a.turn(ctx, r, task, nil)
+}
+
+// turn works on a task until the model answers without calling a tool. Delegating agents get extra tools.
+func (a *Agent) turn(ctx context.Context, r *run, task string, extra []Tool) (output string, err error) {
+	number, err := r.beginStep(a.Name, task)
+	if err != nil {
+		return "", err
+	}
+	// Workers add steps while this one runs, so it's looked up by number once done
+	defer func() {
+		step := &r.steps[number-1]
+		step.Output = output
+		step.End = time.Now()
+		if err != nil {
+			step.Error = err.Error()
+		}
+		if r.engine.options.OnStep != nil {
+			r.engine.options.OnStep(*step)
+		}
+	}()
+
+	ctx, span := internal.StartSpan(ctx, internal.SpanAgent, a.Name)
+	span.Input = task
+	span.SetAttribute("step", number)
+	defer func() {
+		span.Output = output
+		span.Finish(err)
+	}()
+
+	tools := append(append([]Tool(nil), a.Tools...), extra...)
+	definitions := make([]internal.ToolDefinition, 0, len(tools))
+	for _, tool := range tools {
+		parameters := tool.Parameters
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		definitions = append(definitions, internal.ToolDefinition{Name: tool.Name, Description: tool.Description, Parameters: parameters})
+	}
+
+	messages := []internal.Message{
+		{Role: "system", Content: a.instructions(r.state)},
+		{Role: "user", Content: task},
+	}
+
+	for round := 0; round < r.engine.options.MaxToolRounds; round++ {
+		// Tools may have changed the shared state or the briefing since the last call
+		messages[0].Content = a.instructions(r.state)
+
+		reply, err := r.engine.model.Chat(ctx, internal.ChatRequest{
+			Model:       a.Model,
+			Messages:    messages,
+			Tools:       definitions,
+			Temperature: r.engine.options.Temperature,
+			Agent:       a.Name,
+			Step:        number,
+		})
+		if len(reply.ToolCalls) == 0 {
+			// A truncated answer is returned along with the error
+			return reply.Content, err
+		}
+		if err != nil {
+			return "", err
+		}
+		messages = append(messages, reply)
+
+		for _, call := range reply.ToolCalls {
+			observation, err := r.callTool(ctx, a.Name, tools, call)
+			if err != nil {
+				return "", err
+			}
+			messages = append(messages, internal.Message{Role: "tool", Content: observation, ToolCallID: call.ID})
+		}
+	}
+
+	return "", fmt.Errorf("agent %s made no answer in %d model calls", a.Name, r.engine.options.MaxToolRounds)
+}
+
+// instructions appends the briefing and the shared state to the agent's instructions
+func (a *Agent) instructions(state *State) string {
+	instructions := a.Instructions
+	if a.Briefing != nil {
+		instructions += a.Briefing()
+	}
+
+	values := state.Values()
+	if len(values) == 0 {
+		return instructions
+	}
+
+	data, _ := json.MarshalIndent(values, "", "  ")
+	return instructions + "\n\nShared state:\n" + string(data)
+}
+
+// callTool runs a tool call. Recoverable errors are returned as the observation, fatal ones end the turn.
+func (r *run) callTool(ctx context.Context, agent string, tools []Tool, call internal.ToolCall) (observation string, err error) {
+	ctx, span := internal.StartSpan(ctx, internal.SpanTool, call.Name)
+	span.Input = call.Arguments
+	span.SetAttribute("agent", agent)
+	defer func() {
+		r.engine.tracker.RecordTool(agent, call.Name, time.Since(span.Start))
+		span.Output = observation
+		span.Finish(err)
+	}()
+
+	var tool *Tool
+	for i := range tools {
+		if tools[i].Name == call.Name {
+			tool = &tools[i]
+		}
+	}
+	if tool == nil {
+		return fmt.Sprintf("Error: unknown tool %s", call.Name), nil
+	}
+
+	var args map[string]any
+	if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil && call.Arguments != "" {
+		return fmt.Sprintf("Error: invalid arguments: %v", err), nil
+	}
+
+	observation, err = tool.Run(ctx, r.state, args)
+	if err != nil {
+		toolErr := internal.NewToolError(call.Name, err)
+		if toolErr.Fatal {
+			return "", toolErr
+		}
+		return toolErr.Observation(), nil
+	}
+
+	return observation, nil
+}
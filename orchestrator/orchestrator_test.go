@@ -0,0 +1,385 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+)
+
+// respond answers a chat request of an agent
+type respond func(ctx context.Context, request internal.ChatRequest) (internal.Message, error)
+
+// fakeModel answers every agent with its respond function and keeps the requests it got
+type fakeModel struct {
+	agents map[string]respond
+
+	mu       sync.Mutex
+	requests []internal.ChatRequest
+}
+
+func (m *fakeModel) Chat(ctx context.Context, request internal.ChatRequest) (internal.Message, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, request)
+	m.mu.Unlock()
+
+	agent, ok := m.agents[request.Agent]
+	if !ok {
+		return internal.Message{}, fmt.Errorf("no responses for agent %s", request.Agent)
+	}
+	return agent(ctx, request)
+}
+
+// observations returns the tool results the agent was shown in its last request
+func (m *fakeModel) observations(agent string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var observations []string
+	for i := len(m.requests) - 1; i >= 0; i-- {
+		if m.requests[i].Agent != agent {
+			continue
+		}
+		for _, message := range m.requests[i].Messages {
+			if message.Role == "tool" {
+				observations = append(observations, message.Content)
+			}
+		}
+		break
+	}
+	return observations
+}
+
+// script replies with the replies in order, one per model call of a turn, and the last one after that
+func script(replies ...internal.Message) respond {
+	return func(ctx context.Context, request internal.ChatRequest) (internal.Message, error) {
+		var round int
+		for _, message := range request.Messages {
+			if message.Role == "assistant" {
+				round++
+			}
+		}
+		return replies[min(round, len(replies)-1)], nil
+	}
+}
+
+// echo answers every task with "done: <task>", failing like a real model once ctx is done
+func echo(ctx context.Context, request internal.ChatRequest) (internal.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return internal.Message{}, err
+	}
+	return answer("done: " + request.Messages[1].Content), nil
+}
+
+// answer is a final reply
+func answer(content string) internal.Message {
+	return internal.Message{Role: "assistant", Content: content}
+}
+
+// call is a reply calling a tool with the arguments
+func call(tool string, args map[string]any) internal.Message {
+	data, _ := json.Marshal(args)
+	return internal.Message{Role: "assistant", ToolCalls: []internal.ToolCall{{ID: "call-" + tool, Name: tool, Arguments: string(data)}}}
+}
+
+// delegate is a reply handing the message to the worker
+func delegate(worker, message string) internal.Message {
+	return call("transfer_to_"+worker, map[string]any{"message": message})
+}
+
+// stepAgents returns the agents of the steps in order
+func stepAgents(steps []Step) []string {
+	agents := make([]string, len(steps))
+	for i, step := range steps {
+		agents[i] = step.Agent
+	}
+	return agents
+}
+
+func TestParseCyclePolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		want CyclePolicy
+		err  bool
+	}{
+		{name: "", want: CycleAllow},
+		{name: "allow", want: CycleAllow},
+		{name: "reject", want: CycleReject},
+		{name: "fail", want: CycleFail},
+		{name: "ignore", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCyclePolicy(tt.name)
+			if (err != nil) != tt.err {
+				t.Fatalf("ParseCyclePolicy(%q) error = %v, want error %v", tt.name, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCyclePolicy(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		// lead are the replies of the lead, the worker answers every task with done: <task>
+		lead   []internal.Message
+		output string
+		// agents are the agents of the steps taken, in order
+		agents []string
+		// observation is part of the last tool result the lead was shown, if not empty
+		observation string
+		// err is the expected error, nil if the run succeeds
+		err error
+	}{
+		{
+			name:        "delegates and answers",
+			lead:        []internal.Message{delegate("worker", "find it"), answer("found it")},
+			output:      "found it",
+			agents:      []string{"lead", "worker"},
+			observation: "done: find it",
+		},
+		{
+			name:   "answers without delegating",
+			lead:   []internal.Message{answer("I know it")},
+			output: "I know it",
+			agents: []string{"lead"},
+		},
+		{
+			name:   "repeated handoff allowed",
+			lead:   []internal.Message{delegate("worker", "find it"), delegate("worker", "Find  it"), answer("found it")},
+			output: "found it",
+			agents: []string{"lead", "worker", "worker"},
+		},
+		{
+			name:        "repeated handoff rejected",
+			options:     Options{CyclePolicy: CycleReject},
+			lead:        []internal.Message{delegate("worker", "find it"), delegate("worker", "Find  it"), answer("found it")},
+			output:      "found it",
+			agents:      []string{"lead", "worker"},
+			observation: "Handoff refused: worker already got this task",
+		},
+		{
+			name:    "repeated handoff fails",
+			options: Options{CyclePolicy: CycleFail},
+			lead:    []internal.Message{delegate("worker", "find it"), delegate("worker", "find it"), answer("found it")},
+			agents:  []string{"lead", "worker"},
+			err:     ErrCycle,
+		},
+		{
+			name:        "other tasks allowed",
+			options:     Options{CyclePolicy: CycleFail},
+			lead:        []internal.Message{delegate("worker", "find it"), delegate("worker", "check it"), answer("checked it")},
+			output:      "checked it",
+			agents:      []string{"lead", "worker", "worker"},
+			observation: "done: check it",
+		},
+		{
+			name:        "too many visits rejected",
+			options:     Options{MaxVisits: 1, CyclePolicy: CycleReject},
+			lead:        []internal.Message{delegate("worker", "find it"), delegate("worker", "check it"), answer("found it")},
+			output:      "found it",
+			agents:      []string{"lead", "worker"},
+			observation: "Handoff refused",
+		},
+		{
+			name:        "too many visits allowed",
+			options:     Options{MaxVisits: 1},
+			lead:        []internal.Message{delegate("worker", "find it"), delegate("worker", "check it"), answer("checked it")},
+			output:      "checked it",
+			agents:      []string{"lead", "worker", "worker"},
+			observation: "done: check it",
+		},
+		{
+			name: "handoff refused by the check",
+			options: Options{CheckHandoff: func(from, to string) error {
+				if from == "lead" && to == "worker" {
+					return errors.New("the draft is closed")
+				}
+				return nil
+			}},
+			lead:        []internal.Message{delegate("worker", "find it"), answer("no draft")},
+			output:      "no draft",
+			agents:      []string{"lead"},
+			observation: "Handoff refused: the draft is closed",
+		},
+		{
+			name:    "step limit",
+			options: Options{MaxSteps: 2},
+			lead:    []internal.Message{delegate("worker", "find it"), delegate("worker", "check it"), answer("checked it")},
+			agents:  []string{"lead", "worker"},
+			err:     ErrStepLimit,
+		},
+		{
+			name:        "missing message",
+			lead:        []internal.Message{call("transfer_to_worker", map[string]any{}), answer("gave up")},
+			output:      "gave up",
+			agents:      []string{"lead"},
+			observation: "Error: message is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &fakeModel{agents: map[string]respond{"lead": script(tt.lead...), "worker": echo}}
+
+			var onStep []string
+			tt.options.OnStep = func(step Step) { onStep = append(onStep, step.Agent) }
+
+			supervisor := &Supervisor{
+				Lead:    &Agent{Name: "lead"},
+				Workers: []Node{&Agent{Name: "worker", Description: "Finds things"}},
+			}
+			result, err := New(model, internal.NewUsageTracker(nil), tt.options).Run(context.Background(), supervisor, "question", nil)
+
+			if tt.err == nil && err != nil {
+				t.Fatalf("Run() error = %v, want none", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("Run() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil && !internal.IsFatal(err) {
+				t.Errorf("Run() error = %v is not fatal", err)
+			}
+			if result.Output != tt.output {
+				t.Errorf("Run() output = %q, want %q", result.Output, tt.output)
+			}
+			if got := stepAgents(result.Steps); !slices.Equal(got, tt.agents) {
+				t.Errorf("Run() steps = %v, want %v", got, tt.agents)
+			}
+			// Steps are reported as they finish, so a worker's before the lead's
+			if got, want := slices.Sorted(slices.Values(onStep)), slices.Sorted(slices.Values(tt.agents)); !slices.Equal(got, want) {
+				t.Errorf("OnStep saw %v, want the steps %v", onStep, tt.agents)
+			}
+
+			if tt.observation != "" {
+				observations := model.observations("lead")
+				if len(observations) == 0 || !strings.Contains(observations[len(observations)-1], tt.observation) {
+					t.Errorf("lead was shown %q, want the last to contain %q", observations, tt.observation)
+				}
+			}
+		})
+	}
+}
+
+func TestToolErrors(t *testing.T) {
+	// lookup fails with the error of its key argument
+	errs := map[string]error{
+		"unreachable": errors.New("site unreachable"),
+		"cancelled":   context.Canceled,
+		"rejected":    &internal.StatusError{Service: "search", StatusCode: http.StatusUnauthorized},
+		"throttled":   &internal.StatusError{Service: "search", StatusCode: http.StatusTooManyRequests},
+	}
+	lookup := Tool{
+		Name: "lookup",
+		Run: func(ctx context.Context, state *State, args map[string]any) (string, error) {
+			key, _ := args["key"].(string)
+			if err, ok := errs[key]; ok {
+				return "", err
+			}
+			state.Set(key, "found")
+			return "value of " + key, nil
+		},
+	}
+
+	tests := []struct {
+		name    string
+		options Options
+		replies []internal.Message
+		output  string
+		// observation is part of the last tool result the agent was shown, if not empty
+		observation string
+		// err is part of the expected fatal error, empty if the run succeeds
+		err string
+	}{
+		{
+			name:        "result",
+			replies:     []internal.Message{call("lookup", map[string]any{"key": "weather"}), answer("sunny")},
+			output:      "sunny",
+			observation: "value of weather",
+		},
+		{
+			name:        "recoverable error",
+			replies:     []internal.Message{call("lookup", map[string]any{"key": "unreachable"}), answer("no luck")},
+			output:      "no luck",
+			observation: "Error: site unreachable",
+		},
+		{
+			name:        "recoverable status",
+			replies:     []internal.Message{call("lookup", map[string]any{"key": "throttled"}), answer("no luck")},
+			output:      "no luck",
+			observation: "Error: search returned unexpected status code: 429",
+		},
+		{
+			name:    "cancelled",
+			replies: []internal.Message{call("lookup", map[string]any{"key": "cancelled"}), answer("no luck")},
+			err:     "tool lookup failed: context canceled",
+		},
+		{
+			name:    "rejected key",
+			replies: []internal.Message{call("lookup", map[string]any{"key": "rejected"}), answer("no luck")},
+			err:     "search returned unexpected status code: 401",
+		},
+		{
+			name:        "unknown tool",
+			replies:     []internal.Message{call("search", map[string]any{"query": "weather"}), answer("no tool")},
+			output:      "no tool",
+			observation: "Error: unknown tool search",
+		},
+		{
+			name: "invalid arguments",
+			replies: []internal.Message{
+				{Role: "assistant", ToolCalls: []internal.ToolCall{{ID: "call-lookup", Name: "lookup", Arguments: "{"}}},
+				answer("bad call"),
+			},
+			output:      "bad call",
+			observation: "Error: invalid arguments",
+		},
+		{
+			name:    "tool rounds used up",
+			options: Options{MaxToolRounds: 2},
+			replies: []internal.Message{call("lookup", map[string]any{"key": "weather"})},
+			err:     "agent agent made no answer in 2 model calls",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &fakeModel{agents: map[string]respond{"agent": script(tt.replies...)}}
+			agent := &Agent{Name: "agent", Tools: []Tool{lookup}}
+
+			result, err := New(model, internal.NewUsageTracker(nil), tt.options).Run(context.Background(), agent, "question", nil)
+
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Run() error = %v, want none", err)
+				}
+			} else {
+				if err == nil || !strings.Contains(err.Error(), tt.err) || !internal.IsFatal(err) {
+					t.Fatalf("Run() error = %v, want a fatal error containing %q", err, tt.err)
+				}
+			}
+			if result.Output != tt.output {
+				t.Errorf("Run() output = %q, want %q", result.Output, tt.output)
+			}
+
+			if tt.observation != "" {
+				observations := model.observations("agent")
+				if len(observations) == 0 || !strings.Contains(observations[len(observations)-1], tt.observation) {
+					t.Errorf("agent was shown %q, want the last to contain %q", observations, tt.observation)
+				}
+			}
+		})
+	}
+}
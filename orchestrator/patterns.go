@@ -0,0 +1,149 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+)
+
+// Supervisor is a team whose lead agent delegates tasks to the workers with a transfer_to_<worker> tool
+// and answers once it has what it needs. Workers may be agents, pipelines or other supervisors.
+type Supervisor struct {
+	// Name defaults to the lead's name
+	Name        string
+	Description string
+	Lead        *Agent
+	Workers     []Node
+}
+
+func (s *Supervisor) describe() (string, string) {
+	name, description := s.Lead.describe()
+	if s.Name != "" {
+		name = s.Name
+	}
+	if s.Description != "" {
+		description = s.Description
+	}
+	return name, description
+}
+
+func (s *Supervisor) handle(ctx context.Context, r *run, task string) (string, error) {
+	tools := make([]Tool, 0, len(s.Workers))
+	for _, worker := range s.Workers {
+		tools = append(tools, s.handoffTool(r, worker))
+	}
+
+	return s.Lead.turn(ctx, r, task, tools)
+}
+
+// handoffTool hands a task to a worker and returns the worker's result to the lead
+func (s *Supervisor) handoffTool(r *run, worker Node) Tool {
+	name, description := worker.describe()
+
+	return Tool{
+		Name:        "transfer_to_" + name,
+		Description: fmt.Sprintf("Hand a task to %s and get its result. %s", name, description),
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"message": map[string]any{
+					"type":        "string",
+					"description": "The task, with everything the worker needs to know to do it",
+				},
+			},
+			"required": []string{"message"},
+		},
+		Run: func(ctx context.Context, state *State, args map[string]any) (string, error) {
+			message, _ := args["message"].(string)
+			if message == "" {
+				return "", fmt.Errorf("message is required")
+			}
+
+			output, err := r.handoff(ctx, s.Lead.Name, worker, message)
+			if err != nil {
+				// The worker's own tool errors were already handled, whatever is left ends the run
+				return "", &internal.ToolError{Tool: "transfer_to_" + name, Fatal: true, Err: err}
+			}
+			return output, nil
+		},
+	}
+}
+
+// Pipeline passes a task through its stages in order, each getting the previous stage's output
+type Pipeline struct {
+	Name        string
+	Description string
+	Stages      []Node
+}
+
+func (p *Pipeline) describe() (string, string) {
+	return p.Name, p.Description
+}
+
+func (p *Pipeline) handle(ctx context.Context, r *run, task string) (string, error) {
+	from := p.Name
+	input := task
+
+	for _, stage := range p.Stages {
+		output, err := r.handoff(ctx, from, stage, input)
+		if err != nil {
+			return output, err
+		}
+
+		from, _ = stage.describe()
+		input = output
+	}
+
+	return input, nil
+}
+
+// Subtask is a task of a fan-out and its outcome
+type Subtask struct {
+	Task   string
+	Output string
+	Steps  []Step
+	Err    error
+}
+
+// FanOut hands every task to node concurrently, each in a run of its own with a fresh state, at most
+// concurrency at a time. A subtask running longer than timeout is cancelled, 0 means no limit.
+// The subtasks are returned in the order of tasks.
+func (e *Engine) FanOut(ctx context.Context, node Node, tasks []string, concurrency int, timeout time.Duration) []Subtask {
+	if concurrency <= 0 {
+		concurrency = len(tasks)
+	}
+
+	subtasks := make([]Subtask, len(tasks))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				subtasks[i] = Subtask{Task: task, Err: ctx.Err()}
+				return
+			}
+
+			subtaskCtx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				subtaskCtx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			result, err := e.Run(subtaskCtx, node, task, nil)
+			subtasks[i] = Subtask{Task: task, Output: result.Output, Steps: result.Steps, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	return subtasks
+}
@@ -0,0 +1,148 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RB387/wolt-ai-agents-talk/internal"
+)
+
+func TestPipeline(t *testing.T) {
+	model := &fakeModel{agents: map[string]respond{"draft": echo, "edit": echo}}
+	pipeline := &Pipeline{Name: "report", Stages: []Node{&Agent{Name: "draft"}, &Agent{Name: "edit"}}}
+
+	result, err := New(model, internal.NewUsageTracker(nil), Options{}).Run(context.Background(), pipeline, "topic", nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if want := "done: done: topic"; result.Output != want {
+		t.Errorf("Run() output = %q, want %q", result.Output, want)
+	}
+	if got, want := stepAgents(result.Steps), []string{"draft", "edit"}; !slices.Equal(got, want) {
+		t.Errorf("Run() steps = %v, want %v", got, want)
+	}
+
+	var handoffs []string
+	for _, handoff := range result.State.Handoffs() {
+		handoffs = append(handoffs, handoff.From+" -> "+handoff.To)
+	}
+	want := []string{"user -> report", "report -> draft", "draft -> report", "draft -> edit", "edit -> draft", "report -> user"}
+	if !slices.Equal(handoffs, want) {
+		t.Errorf("handoffs = %v, want %v", handoffs, want)
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	// delays makes the later tasks finish first, slow only finishes when cancelled
+	delays := map[string]time.Duration{"a": 30 * time.Millisecond, "b": 20 * time.Millisecond, "c": 10 * time.Millisecond, "slow": time.Hour}
+
+	tests := []struct {
+		name        string
+		tasks       []string
+		concurrency int
+		timeout     time.Duration
+		// outputs are the expected outputs in the order of the tasks, empty for failed subtasks
+		outputs []string
+		// failed are the tasks expected to fail with context.DeadlineExceeded
+		failed []string
+	}{
+		{
+			name:    "order of tasks",
+			tasks:   []string{"a", "b", "c"},
+			outputs: []string{"done: a", "done: b", "done: c"},
+		},
+		{
+			name:        "limited concurrency",
+			tasks:       []string{"a", "b", "c", "a", "b"},
+			concurrency: 2,
+			outputs:     []string{"done: a", "done: b", "done: c", "done: a", "done: b"},
+		},
+		{
+			name:    "timeout",
+			tasks:   []string{"a", "slow", "c"},
+			timeout: 200 * time.Millisecond,
+			outputs: []string{"done: a", "", "done: c"},
+			failed:  []string{"slow"},
+		},
+		{
+			name:  "no tasks",
+			tasks: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var running, maxRunning int
+
+			model := &fakeModel{agents: map[string]respond{
+				"scraper": func(ctx context.Context, request internal.ChatRequest) (internal.Message, error) {
+					mu.Lock()
+					running++
+					maxRunning = max(maxRunning, running)
+					mu.Unlock()
+					defer func() {
+						mu.Lock()
+						running--
+						mu.Unlock()
+					}()
+
+					select {
+					case <-time.After(delays[request.Messages[1].Content]):
+						return echo(ctx, request)
+					case <-ctx.Done():
+						return internal.Message{}, ctx.Err()
+					}
+				},
+			}}
+			engine := New(model, internal.NewUsageTracker(nil), Options{})
+
+			subtasks := engine.FanOut(context.Background(), &Agent{Name: "scraper"}, tt.tasks, tt.concurrency, tt.timeout)
+
+			if len(subtasks) != len(tt.tasks) {
+				t.Fatalf("FanOut() returned %d subtasks, want %d", len(subtasks), len(tt.tasks))
+			}
+			for i, subtask := range subtasks {
+				if subtask.Task != tt.tasks[i] {
+					t.Errorf("subtask %d is %q, want %q", i, subtask.Task, tt.tasks[i])
+				}
+				if subtask.Output != tt.outputs[i] {
+					t.Errorf("subtask %d output = %q, want %q", i, subtask.Output, tt.outputs[i])
+				}
+
+				failed := slices.Contains(tt.failed, subtask.Task)
+				switch {
+				case failed && !errors.Is(subtask.Err, context.DeadlineExceeded):
+					t.Errorf("subtask %d error = %v, want %v", i, subtask.Err, context.DeadlineExceeded)
+				case !failed && subtask.Err != nil:
+					t.Errorf("subtask %d error = %v, want none", i, subtask.Err)
+				case !failed && len(subtask.Steps) != 1:
+					t.Errorf("subtask %d took %d steps, want 1", i, len(subtask.Steps))
+				}
+			}
+
+			if tt.concurrency > 0 && maxRunning > tt.concurrency {
+				t.Errorf("%d subtasks ran at once, want at most %d", maxRunning, tt.concurrency)
+			}
+		})
+	}
+}
+
+func TestFanOutCancelled(t *testing.T) {
+	model := &fakeModel{agents: map[string]respond{"scraper": echo}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	subtasks := New(model, internal.NewUsageTracker(nil), Options{}).FanOut(ctx, &Agent{Name: "scraper"}, []string{"a", "b"}, 1, 0)
+
+	for i, subtask := range subtasks {
+		if !errors.Is(subtask.Err, context.Canceled) {
+			t.Errorf("subtask %d error = %v, want %v", i, subtask.Err, context.Canceled)
+		}
+	}
+}